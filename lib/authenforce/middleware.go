@@ -24,3 +24,10 @@ func CRPCMiddleware(enforcers Enforcers) crpc.MiddlewareFunc {
 		}
 	}
 }
+
+// Policy returns a crpc auth policy enforcing enforcers, to be passed to
+// RegisterWithOptions in place of CRPCMiddleware. The name describes the
+// policy in introspection and the OpenAPI document.
+func Policy(name string, enforcers Enforcers) crpc.RegisterOption {
+	return crpc.WithAuthPolicy(name, CRPCMiddleware(enforcers))
+}
@@ -12,21 +12,23 @@ import (
 	"github.com/wearemojo/mojo-public-go/lib/mlog"
 )
 
-func jsonError(ctx context.Context, res http.ResponseWriter, err error) {
-	res.Header().Set("Content-Type", "application/json; charset=utf-8")
-
-	enc := json.NewEncoder(res)
-	var encErr error
+func jsonError(ctx context.Context, res http.ResponseWriter, req *http.Request, err error) {
+	cerr, ok := errors.AsType[cher.E](err)
+	if !ok {
+		cerr = cher.New(cher.Unknown, cher.M{"error": err})
+	}
 
-	if err, ok := errors.AsType[cher.E](err); ok {
-		res.WriteHeader(err.StatusCode())
-		encErr = enc.Encode(err)
+	var body any = cerr
+	if cher.AcceptsProblem(req.Header.Get("Accept")) {
+		res.Header().Set("Content-Type", cher.ProblemContentType)
+		body = cerr.Problem()
 	} else {
-		res.WriteHeader(http.StatusInternalServerError)
-		encErr = enc.Encode(cher.New(cher.Unknown, cher.M{"error": err}))
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
 	}
 
-	if encErr != nil {
+	res.WriteHeader(cerr.StatusCode())
+
+	if encErr := json.NewEncoder(res).Encode(body); encErr != nil {
 		mlog.Error(ctx, merr.New(ctx, "error_encode_failed", nil, encErr))
 	}
 }
@@ -41,7 +43,7 @@ func Middleware(parser Parser) func(http.Handler) http.Handler {
 			authState, err := parser.Check(ctx, authzHeader)
 			if err != nil && !errors.Is(err, ErrNoAuthorization) {
 				clog.SetError(ctx, err)
-				jsonError(ctx, res, err)
+				jsonError(ctx, res, req, err)
 
 				if cerr, ok := errors.AsType[cher.E](err); ok && cerr.Code == cher.Unauthorized && len(cerr.Reasons) == 1 {
 					err = cerr.Reasons[0]
@@ -0,0 +1,162 @@
+package cher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// CodeInfo describes an error code, for StatusCode and for client teams.
+type CodeInfo struct {
+	Code string `json:"code"`
+
+	// Status is the HTTP status code errors with the code are returned with
+	Status int `json:"status"`
+
+	Description string `json:"description,omitempty"`
+
+	// Retryable reports whether the same request may succeed if made again
+	Retryable bool `json:"retryable"`
+
+	// MetaKeys are the keys errors with the code are expected to have in
+	// their meta
+	MetaKeys []string `json:"meta_keys,omitempty"`
+}
+
+// Catalog is a registry of error codes.
+type Catalog struct {
+	mu    sync.RWMutex
+	codes map[string]CodeInfo
+}
+
+// NewCatalog returns an empty Catalog.
+func NewCatalog() *Catalog {
+	return &Catalog{codes: map[string]CodeInfo{}}
+}
+
+// defaultCatalog is only ever accessed through DefaultCatalog, so it can't be
+// replaced while in use
+var defaultCatalog = NewCatalog()
+
+// DefaultCatalog returns the catalog StatusCode consults, which has the codes
+// common across services registered. Services register their own codes in it
+// with Register, usually from an init function. It is safe for concurrent use.
+func DefaultCatalog() *Catalog {
+	return defaultCatalog
+}
+
+func init() {
+	defaultCatalog.Register(
+		CodeInfo{Code: BadRequest, Status: http.StatusBadRequest, Description: "The request is invalid", MetaKeys: []string{"message"}},
+		CodeInfo{Code: Unauthorized, Status: http.StatusUnauthorized, Description: "The request has no valid authentication"},
+		CodeInfo{Code: AccessDenied, Status: http.StatusForbidden, Description: "The caller may not make the request"},
+		CodeInfo{Code: NotFound, Status: http.StatusNotFound, Description: "The requested resource doesn't exist"},
+		CodeInfo{Code: RouteNotFound, Status: http.StatusNotFound, Description: "No method exists at the requested path"},
+		CodeInfo{Code: MethodNotAllowed, Status: http.StatusMethodNotAllowed, Description: "The HTTP method isn't supported at the requested path"},
+		CodeInfo{Code: Unknown, Status: http.StatusInternalServerError, Description: "An unexpected error occurred", MetaKeys: []string{"message"}},
+		CodeInfo{Code: EndpointWithdrawn, Status: http.StatusGone, Description: "The method has been withdrawn at the requested version"},
+		CodeInfo{Code: TooManyRequests, Status: http.StatusTooManyRequests, Description: "The caller has made too many requests", Retryable: true},
+		CodeInfo{Code: ContextCanceled, Status: http.StatusBadRequest, Description: "The request was canceled by the caller"},
+		CodeInfo{Code: EOF, Status: http.StatusBadRequest, Description: "The request body is empty"},
+		CodeInfo{Code: UnexpectedEOF, Status: http.StatusBadRequest, Description: "The request body ended unexpectedly", Retryable: true},
+		CodeInfo{Code: RequestTimeout, Status: http.StatusInternalServerError, Description: "The request didn't complete in time", Retryable: true},
+		CodeInfo{Code: RequestTooLarge, Status: http.StatusRequestEntityTooLarge, Description: "The request body is too large", MetaKeys: []string{"max_body_size"}},
+		CodeInfo{Code: ThirdPartyTimeout, Status: http.StatusBadRequest, Description: "A third party didn't respond in time", Retryable: true},
+		CodeInfo{Code: CircuitOpen, Status: http.StatusServiceUnavailable, Description: "Calls to the method are paused while it keeps failing", Retryable: true, MetaKeys: []string{"base_url", "method"}},
+		CodeInfo{Code: IdempotencyKeyInUse, Status: http.StatusConflict, Description: "A request with the same idempotency key is in progress", Retryable: true},
+		CodeInfo{Code: IdempotencyKeyReused, Status: http.StatusUnprocessableEntity, Description: "The idempotency key was used with a different request"},
+		CodeInfo{Code: CoercionError, Status: http.StatusInternalServerError, Description: "An error couldn't be interpreted", MetaKeys: []string{"message"}},
+	)
+}
+
+// Register adds codes to the catalog. It panics if a code has no status, or
+// was already registered differently, as either is a programming error.
+// Registering the same info again does nothing.
+func (c *Catalog) Register(infos ...CodeInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, info := range infos {
+		if info.Code == "" || info.Status == 0 {
+			panic(fmt.Sprintf("cher: code %q must have a code and status", info.Code))
+		}
+
+		if existing, ok := c.codes[info.Code]; ok {
+			if !reflect.DeepEqual(existing, info) {
+				panic(fmt.Sprintf("cher: code %q is already registered differently", info.Code))
+			}
+
+			continue
+		}
+
+		info.MetaKeys = slices.Clone(info.MetaKeys)
+		c.codes[info.Code] = info
+	}
+}
+
+// Lookup returns the info registered for a code.
+func (c *Catalog) Lookup(code string) (CodeInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	info, ok := c.codes[code]
+	return info, ok
+}
+
+// Codes returns every registered code, sorted by code.
+func (c *Catalog) Codes() []CodeInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	codes := make([]CodeInfo, 0, len(c.codes))
+	for _, info := range c.codes {
+		codes = append(codes, info)
+	}
+
+	slices.SortFunc(codes, func(a, b CodeInfo) int {
+		return strings.Compare(a.Code, b.Code)
+	})
+
+	return codes
+}
+
+// MarshalJSON exports the catalog as a list of codes, sorted by code.
+func (c *Catalog) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.Codes())
+}
+
+// Registered reports whether err is either not a cher error, or has a
+// registered code, as do all of its reasons at any depth. It's intended for
+// tests asserting that handlers only return documented codes.
+func (c *Catalog) Registered(err error) bool {
+	var cErr E
+	if !errors.As(err, &cErr) {
+		return true
+	}
+
+	return c.registered(cErr)
+}
+
+func (c *Catalog) registered(err E) bool {
+	if _, ok := c.Lookup(err.Code); !ok {
+		return false
+	}
+
+	for _, reason := range err.Reasons {
+		if !c.registered(reason) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Register adds codes to the default catalog.
+func Register(infos ...CodeInfo) {
+	defaultCatalog.Register(infos...)
+}
@@ -0,0 +1,111 @@
+package cher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/pkg/errors"
+)
+
+func TestCatalog(t *testing.T) {
+	t.Run("Register", func(t *testing.T) {
+		is := is.New(t)
+
+		c := NewCatalog()
+		c.Register(CodeInfo{Code: "payment_declined", Status: http.StatusPaymentRequired, MetaKeys: []string{"reason"}})
+
+		info, ok := c.Lookup("payment_declined")
+		is.True(ok)
+		is.Equal(info.Status, http.StatusPaymentRequired)
+		is.Equal(info.MetaKeys, []string{"reason"})
+
+		_, ok = c.Lookup("missing")
+		is.True(!ok)
+	})
+
+	t.Run("RegisterAgain", func(t *testing.T) {
+		c := NewCatalog()
+		c.Register(CodeInfo{Code: "foo", Status: http.StatusConflict})
+		c.Register(CodeInfo{Code: "foo", Status: http.StatusConflict})
+	})
+
+	t.Run("RegisterConflict", func(t *testing.T) {
+		is := is.New(t)
+
+		c := NewCatalog()
+		c.Register(CodeInfo{Code: "foo", Status: http.StatusConflict})
+
+		defer func() {
+			is.True(recover() != nil) // conflicting registrations panic
+		}()
+
+		c.Register(CodeInfo{Code: "foo", Status: http.StatusNotFound})
+	})
+
+	t.Run("RegisterMissingStatus", func(t *testing.T) {
+		is := is.New(t)
+
+		defer func() {
+			is.True(recover() != nil) // codes without a status panic
+		}()
+
+		NewCatalog().Register(CodeInfo{Code: "foo"})
+	})
+
+	t.Run("MarshalJSON", func(t *testing.T) {
+		is := is.New(t)
+
+		c := NewCatalog()
+		c.Register(
+			CodeInfo{Code: "b", Status: http.StatusConflict, Retryable: true},
+			CodeInfo{Code: "a", Status: http.StatusNotFound, Description: "Not here"},
+		)
+
+		data, err := json.Marshal(c)
+		is.NoErr(err)
+		is.Equal(string(data), `[{"code":"a","status":404,"description":"Not here","retryable":false},{"code":"b","status":409,"retryable":true}]`)
+	})
+
+	t.Run("Registered", func(t *testing.T) {
+		is := is.New(t)
+
+		c := NewCatalog()
+		c.Register(CodeInfo{Code: "foo", Status: http.StatusConflict})
+
+		is.True(c.Registered(nil))
+		is.True(c.Registered(errors.New("not a cher")))
+		is.True(c.Registered(errors.Wrap(New("foo", nil), "wrapped")))
+		is.True(!c.Registered(New("bar", nil)))
+		is.True(c.Registered(New("foo", nil, New("foo", nil))))
+		is.True(!c.Registered(New("foo", nil, New("foo", nil, New("bar", nil))))) // reasons are checked at any depth
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+
+		for i := range 10 {
+			wg.Go(func() {
+				code := fmt.Sprintf("catalog_test_concurrent_%d", i)
+				Register(CodeInfo{Code: code, Status: http.StatusConflict})
+
+				_, _ = DefaultCatalog().Lookup(code)
+				_ = New(code, nil).StatusCode()
+				_ = DefaultCatalog().Codes()
+			})
+		}
+
+		wg.Wait()
+	})
+
+	t.Run("StatusCode", func(t *testing.T) {
+		is := is.New(t)
+
+		Register(CodeInfo{Code: "catalog_test_conflict", Status: http.StatusConflict})
+
+		is.Equal(New("catalog_test_conflict", nil).StatusCode(), http.StatusConflict)
+	})
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/wearemojo/mojo-public-go/lib/gjson"
+	"github.com/wearemojo/mojo-public-go/lib/redact"
 	"github.com/wearemojo/mojo-public-go/lib/stacktrace"
 )
 
@@ -27,7 +28,12 @@ const (
 	EOF               = "eof"
 	UnexpectedEOF     = "unexpected_eof"
 	RequestTimeout    = "request_timeout"
+	RequestTooLarge   = "request_too_large"
 	ThirdPartyTimeout = "third_party_timeout"
+	CircuitOpen       = "circuit_open"
+
+	IdempotencyKeyInUse  = "idempotency_key_in_use"
+	IdempotencyKeyReused = "idempotency_key_reused"
 
 	CoercionError = "unable_to_coerce_error"
 )
@@ -41,6 +47,11 @@ type E struct {
 	stack   []stacktrace.Frame `bson:"-"       json:"-"`
 	Reasons []E                `bson:"reasons" json:"reasons,omitempty"`
 
+	// Message is a user-facing description of the error, in the language of
+	// the user, attached by Messages.Localize. Unlike the "message" meta, it
+	// is suitable for showing to users.
+	Message string `bson:"message,omitempty" json:"message,omitempty"`
+
 	// Extra captures any extra/unexpected additional fields found during JSON
 	// unmarshaling, to avoid loss of data when inspecting logs. It should never
 	// be used intentionally.
@@ -49,6 +60,16 @@ type E struct {
 	Extra map[string]any `bson:"-" json:"_extra,omitempty"`
 }
 
+// MarshalJSON redacts meta marked sensitive by redact.Client, including the
+// meta of reasons, as errors are serialized to be sent to clients.
+func (e E) MarshalJSON() ([]byte, error) {
+	type alias E
+	base := alias(e)
+	base.Meta = redact.ClientMeta(e.Meta)
+
+	return json.Marshal(base)
+}
+
 func (e *E) UnmarshalJSON(data []byte) error {
 	type alias E
 	base, err := gjson.Unmarshal[alias](data)
@@ -64,6 +85,7 @@ func (e *E) UnmarshalJSON(data []byte) error {
 	delete(extra, "code")
 	delete(extra, "meta")
 	delete(extra, "reasons")
+	delete(extra, "message")
 
 	if len(extra) > 0 {
 		base.Extra = extra
@@ -99,33 +121,14 @@ func Errorf(code string, meta M, format string, args ...any) E {
 	}
 }
 
-// StatusCode returns the HTTP Status Code associated with the
-// current error code.
+// StatusCode returns the HTTP Status Code registered for the current error
+// code in DefaultCatalog.
 // Defaults to 400 Bad Request because if something's explicitly
 // handled with Cher, it is considered "by design" and not
 // worthy of a 500, which will alert.
 func (e E) StatusCode() int {
-	switch e.Code {
-	case Unauthorized:
-		return http.StatusUnauthorized
-
-	case AccessDenied:
-		return http.StatusForbidden
-
-	case NotFound, RouteNotFound:
-		return http.StatusNotFound
-
-	case MethodNotAllowed:
-		return http.StatusMethodNotAllowed
-
-	case EndpointWithdrawn:
-		return http.StatusGone
-
-	case TooManyRequests:
-		return http.StatusTooManyRequests
-
-	case Unknown, CoercionError, RequestTimeout:
-		return http.StatusInternalServerError
+	if info, ok := DefaultCatalog().Lookup(e.Code); ok {
+		return info.Status
 	}
 
 	return http.StatusBadRequest
@@ -1,12 +1,16 @@
 package cher
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/matryer/is"
 	"github.com/pkg/errors"
+	"github.com/wearemojo/mojo-public-go/lib/redact"
 )
 
 func TestE(t *testing.T) {
@@ -51,6 +55,10 @@ func TestE(t *testing.T) {
 			{"AccessDenied", E{Code: AccessDenied}, http.StatusForbidden},
 			{"NotFound", E{Code: NotFound}, http.StatusNotFound},
 			{"Unknown", E{Code: Unknown}, http.StatusInternalServerError},
+			{"RequestTooLarge", E{Code: RequestTooLarge}, http.StatusRequestEntityTooLarge},
+			{"CircuitOpen", E{Code: CircuitOpen}, http.StatusServiceUnavailable},
+			{"IdempotencyKeyInUse", E{Code: IdempotencyKeyInUse}, http.StatusConflict},
+			{"IdempotencyKeyReused", E{Code: IdempotencyKeyReused}, http.StatusUnprocessableEntity},
 			{"Handled", E{Code: "some_developer_code"}, http.StatusBadRequest},
 		}
 
@@ -279,3 +287,56 @@ func TestAsCherWithCode(t *testing.T) {
 		})
 	}
 }
+
+func TestSensitiveMetaIsRedacted(t *testing.T) {
+	is := is.New(t)
+
+	e := New(BadRequest, M{
+		"email": redact.Wrap("user@example.com"),
+		"token": "secret-token",
+	}, New("invalid_field", M{"password": "hunter2"}))
+
+	messages := MustLoadMessages(fstest.MapFS{
+		"en.json": {Data: []byte(`{"bad_request": "Invalid token {token} for {email}"}`)},
+	}, "en")
+
+	problemJSON, err := json.Marshal(e.Problem())
+	is.NoErr(err)
+
+	for name, output := range map[string]string{
+		"Serialize": e.Serialize(),
+		"Problem":   string(problemJSON),
+		"Message":   messages.Localize(e, "en").Message,
+	} {
+		for _, value := range []string{"user@example.com", "secret-token", "hunter2"} {
+			if strings.Contains(output, value) {
+				t.Errorf("%s output contains %q", name, value)
+			}
+		}
+
+		is.True(strings.Contains(output, redact.Placeholder)) // redacted values are marked
+	}
+
+	is.Equal(e.Meta["token"], "secret-token") // the error itself is untouched
+}
+
+func TestClientRedactionPolicy(t *testing.T) {
+	is := is.New(t)
+
+	original := redact.Client()
+	t.Cleanup(func() { redact.SetClient(original) })
+
+	// a service whose clients read the token of a challenge flow
+	redact.SetClient(redact.NewPolicy([]string{"password"}))
+
+	e := New(BadRequest, M{
+		"token":    "challenge-token",
+		"password": "hunter2",
+		"email":    redact.Wrap("user@example.com"),
+	})
+
+	output := e.Serialize()
+	is.True(strings.Contains(output, `"token":"challenge-token"`))
+	is.True(!strings.Contains(output, "hunter2"))
+	is.True(!strings.Contains(output, "user@example.com")) // wrapped values are always redacted
+}
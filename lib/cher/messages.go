@@ -0,0 +1,169 @@
+package cher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/wearemojo/mojo-public-go/lib/redact"
+	"golang.org/x/text/language"
+)
+
+// Messages is a bundle of user-facing messages for error codes, in multiple
+// locales, so every client describes an error with the same words.
+//
+// Messages may reference meta of the error in braces, e.g. "Your card was
+// declined: {reason}". References to missing meta are left as they are, and
+// sensitive meta is redacted.
+type Messages struct {
+	defaultLocale string
+	fallbacks     map[string][]string
+	messages      map[string]map[string]string
+}
+
+// LoadMessages loads a bundle from the JSON files at the root of fsys, which
+// will typically be an embed.FS. Each file is named after its locale, e.g.
+// `en.json` or `pt-BR.json`, and maps codes to messages. defaultLocale is
+// tried last for every error, and must have a file.
+func LoadMessages(fsys fs.FS, defaultLocale string) (*Messages, error) {
+	filenames, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Messages{
+		fallbacks: map[string][]string{},
+		messages:  map[string]map[string]string{},
+	}
+
+	for _, filename := range filenames {
+		tag, err := language.Parse(strings.TrimSuffix(filename, path.Ext(filename)))
+		if err != nil {
+			return nil, fmt.Errorf("cher: messages file %q is not named after a locale: %w", filename, err)
+		}
+
+		data, err := fs.ReadFile(fsys, filename)
+		if err != nil {
+			return nil, err
+		}
+
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("cher: messages file %q is invalid: %w", filename, err)
+		}
+
+		m.messages[tag.String()] = messages
+	}
+
+	tag, err := language.Parse(defaultLocale)
+	if err != nil {
+		return nil, fmt.Errorf("cher: default locale %q is invalid: %w", defaultLocale, err)
+	}
+
+	m.defaultLocale = tag.String()
+	if _, ok := m.messages[m.defaultLocale]; !ok {
+		return nil, fmt.Errorf("cher: default locale %q has no messages file", defaultLocale)
+	}
+
+	return m, nil
+}
+
+// MustLoadMessages loads a bundle like LoadMessages, panicking if it can't.
+func MustLoadMessages(fsys fs.FS, defaultLocale string) *Messages {
+	m, err := LoadMessages(fsys, defaultLocale)
+	if err != nil {
+		panic(err)
+	}
+
+	return m
+}
+
+// SetFallbacks sets the locales tried, in order, when a locale has no message
+// for a code, before its parent locale, e.g. "es-419" for "es-MX" ahead of
+// "es".
+func (m *Messages) SetFallbacks(locale string, fallbacks ...string) {
+	canonical := make([]string, len(fallbacks))
+	for i, fallback := range fallbacks {
+		canonical[i] = canonicalLocale(fallback)
+	}
+
+	m.fallbacks[canonicalLocale(locale)] = canonical
+}
+
+// Message returns the message for a code in the locale best matching an
+// Accept-Language header, with meta interpolated.
+func (m *Messages) Message(code string, meta M, acceptLanguage string) (string, bool) {
+	for _, locale := range m.locales(acceptLanguage) {
+		if message, ok := m.messages[locale][code]; ok {
+			return interpolateMessage(message, redact.ClientMeta(meta)), true
+		}
+	}
+
+	return "", false
+}
+
+// Localize returns the error with a message from the bundle in the locale best
+// matching an Accept-Language header, if it has one for the code. Errors which
+// already have a message are returned as they are.
+func (m *Messages) Localize(e E, acceptLanguage string) E {
+	if e.Message != "" {
+		return e
+	}
+
+	if message, ok := m.Message(e.Code, e.Meta, acceptLanguage); ok {
+		e.Message = message
+	}
+
+	return e
+}
+
+// locales returns the locales to try for an Accept-Language header, in order
+func (m *Messages) locales(acceptLanguage string) []string {
+	tags, _, _ := language.ParseAcceptLanguage(acceptLanguage)
+
+	locales := []string{}
+	add := func(locale string) {
+		if !slices.Contains(locales, locale) {
+			locales = append(locales, locale)
+		}
+	}
+
+	for _, tag := range tags {
+		for ; tag != language.Und; tag = tag.Parent() {
+			add(tag.String())
+
+			for _, fallback := range m.fallbacks[tag.String()] {
+				add(fallback)
+			}
+		}
+	}
+
+	add(m.defaultLocale)
+
+	return locales
+}
+
+func canonicalLocale(locale string) string {
+	if tag, err := language.Parse(locale); err == nil {
+		return tag.String()
+	}
+
+	return locale
+}
+
+var messageReferenceRegex = regexp.MustCompile(`\{(\w+)\}`)
+
+func interpolateMessage(message string, meta M) string {
+	return messageReferenceRegex.ReplaceAllStringFunc(message, func(ref string) string {
+		value, ok := meta[ref[1:len(ref)-1]]
+		if !ok {
+			return ref
+		}
+
+		return fmt.Sprint(value)
+	})
+}
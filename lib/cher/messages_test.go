@@ -0,0 +1,78 @@
+package cher
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/matryer/is"
+)
+
+func testMessages(t *testing.T) *Messages {
+	t.Helper()
+
+	m, err := LoadMessages(fstest.MapFS{
+		"en.json":     {Data: []byte(`{"not_found": "We couldn't find that", "payment_declined": "Your card was declined: {reason}", "colour": "Pick a color"}`)},
+		"en-GB.json":  {Data: []byte(`{"colour": "Pick a colour"}`)},
+		"es.json":     {Data: []byte(`{"not_found": "No lo encontramos"}`)},
+		"es-419.json": {Data: []byte(`{"payment_declined": "Tu tarjeta fue rechazada: {reason}"}`)},
+	}, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.SetFallbacks("es-MX", "es-419")
+
+	return m
+}
+
+func TestMessages(t *testing.T) {
+	tests := []struct {
+		Name           string
+		AcceptLanguage string
+		E              E
+		Message        string
+	}{
+		{"Default", "", E{Code: NotFound}, "We couldn't find that"},
+		{"Exact", "es", E{Code: NotFound}, "No lo encontramos"},
+		{"Parent", "es-ES", E{Code: NotFound}, "No lo encontramos"},
+		{"Preference", "fr, es;q=0.8, en;q=0.5", E{Code: NotFound}, "No lo encontramos"},
+		{"Regional", "en-GB", E{Code: "colour"}, "Pick a colour"},
+		{"Fallback", "es-MX", E{Code: "payment_declined", Meta: M{"reason": "fondos insuficientes"}}, "Tu tarjeta fue rechazada: fondos insuficientes"},
+		{"FallbackToDefault", "es", E{Code: "payment_declined", Meta: M{"reason": "expired"}}, "Your card was declined: expired"},
+		{"MissingMeta", "en", E{Code: "payment_declined"}, "Your card was declined: {reason}"},
+		{"Unknown", "en", E{Code: "some_developer_code"}, ""},
+		{"AlreadyLocalized", "es", E{Code: NotFound, Message: "Gone"}, "Gone"},
+	}
+
+	m := testMessages(t)
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			is := is.New(t)
+
+			e := m.Localize(tc.E, tc.AcceptLanguage)
+			is.Equal(e.Code, tc.E.Code)
+			is.Equal(e.Message, tc.Message)
+		})
+	}
+}
+
+func TestLoadMessagesErrors(t *testing.T) {
+	tests := []struct {
+		Name string
+		FS   fstest.MapFS
+	}{
+		{"BadLocale", fstest.MapFS{"en.json": {Data: []byte(`{}`)}, "not a locale.json": {Data: []byte(`{}`)}}},
+		{"BadJSON", fstest.MapFS{"en.json": {Data: []byte(`[]`)}}},
+		{"MissingDefault", fstest.MapFS{"es.json": {Data: []byte(`{}`)}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			is := is.New(t)
+
+			_, err := LoadMessages(tc.FS, "en")
+			is.True(err != nil)
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package cher
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/wearemojo/mojo-public-go/lib/redact"
+)
+
+// ProblemContentType is the media type of RFC 9457 problem details.
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypePrefix is prefixed to error codes to form the type URI of
+// problems. Services with documentation for their codes can set it to its URL.
+var ProblemTypePrefix = "urn:cher:"
+
+// Problem is the RFC 9457 representation of an E, for clients which expect
+// problem details rather than the native envelope. The code, meta and reasons
+// of the error are kept as extension members, so no information is lost.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	Code    string    `json:"code"`
+	Meta    M         `json:"meta,omitempty"`
+	Reasons []Problem `json:"reasons,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// Problem returns the problem details of the error. The title is the
+// description registered in DefaultCatalog, falling back to the code, and the
+// detail is the user-facing message, falling back to the "message" meta if
+// it's a string.
+func (e E) Problem() Problem {
+	p := e.problem()
+	p.Status = e.StatusCode()
+
+	return p
+}
+
+func (e E) problem() Problem {
+	p := Problem{
+		Type:    ProblemTypePrefix + e.Code,
+		Title:   e.Code,
+		Code:    e.Code,
+		Meta:    redact.ClientMeta(e.Meta),
+		Message: e.Message,
+	}
+
+	if info, ok := DefaultCatalog().Lookup(e.Code); ok && info.Description != "" {
+		p.Title = info.Description
+	}
+
+	if e.Message != "" {
+		p.Detail = e.Message
+	} else if message, ok := p.Meta["message"].(string); ok {
+		p.Detail = message
+	}
+
+	for _, reason := range e.Reasons {
+		p.Reasons = append(p.Reasons, reason.problem())
+	}
+
+	return p
+}
+
+// E returns the error the problem details describe. Problems not rendered
+// from an E are given the code at the end of their type URI, and their title,
+// detail and instance as meta.
+func (p Problem) E() E {
+	e := E{
+		Code:    p.Code,
+		Meta:    p.Meta,
+		Message: p.Message,
+	}
+
+	if e.Code == "" {
+		e.Code = problemCode(p.Type)
+
+		if p.Title != "" || p.Detail != "" || p.Instance != "" {
+			e.Meta = M{}
+			for key, value := range map[string]string{"title": p.Title, "message": p.Detail, "instance": p.Instance} {
+				if value != "" {
+					e.Meta[key] = value
+				}
+			}
+		}
+	}
+
+	for _, reason := range p.Reasons {
+		e.Reasons = append(e.Reasons, reason.E())
+	}
+
+	return e
+}
+
+// problemCode derives a code from a problem type URI, being its last path
+// segment, or Unknown when there's nothing to go on
+func problemCode(typ string) string {
+	if typ == "" || typ == "about:blank" {
+		return Unknown
+	}
+
+	typ = strings.TrimPrefix(typ, ProblemTypePrefix)
+	if i := strings.LastIndexAny(typ, "/:#"); i >= 0 {
+		typ = typ[i+1:]
+	}
+
+	if typ == "" {
+		return Unknown
+	}
+
+	return typ
+}
+
+// AcceptsProblem reports whether an Accept header prefers problem details to
+// the native JSON envelope, i.e. lists ProblemContentType with a quality at
+// least that of application/json.
+func AcceptsProblem(accept string) bool {
+	problemQ, jsonQ := 0.0, 0.0
+
+	for accepted := range strings.SplitSeq(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case ProblemContentType:
+			problemQ = max(problemQ, q)
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		}
+	}
+
+	return problemQ > 0 && problemQ >= jsonQ
+}
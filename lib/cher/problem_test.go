@@ -0,0 +1,88 @@
+package cher
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestProblem(t *testing.T) {
+	t.Run("RoundTrip", func(t *testing.T) {
+		is := is.New(t)
+
+		e := E{
+			Code:    BadRequest,
+			Meta:    M{"message": "name is required"},
+			Reasons: []E{{Code: "schema_failure", Meta: M{"field": "name"}}},
+		}
+
+		data, err := json.Marshal(e.Problem())
+		is.NoErr(err)
+		is.Equal(string(data), `{"type":"urn:cher:bad_request","title":"The request is invalid","status":400,"detail":"name is required","code":"bad_request","meta":{"message":"name is required"},"reasons":[{"type":"urn:cher:schema_failure","title":"schema_failure","code":"schema_failure","meta":{"field":"name"}}]}`)
+
+		var p Problem
+		is.NoErr(json.Unmarshal(data, &p))
+		is.Equal(p.E(), e)
+	})
+
+	t.Run("Foreign", func(t *testing.T) {
+		tests := []struct {
+			Name    string
+			Problem string
+			E       E
+		}{
+			{
+				"TypeURI",
+				`{"type":"https://example.com/probs/out-of-credit","title":"You do not have enough credit.","status":403,"detail":"Your balance is 30.","instance":"/account/12345/msgs/abc"}`,
+				E{Code: "out-of-credit", Meta: M{"title": "You do not have enough credit.", "message": "Your balance is 30.", "instance": "/account/12345/msgs/abc"}},
+			},
+			{
+				"Blank",
+				`{"type":"about:blank","status":503}`,
+				E{Code: Unknown},
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.Name, func(t *testing.T) {
+				is := is.New(t)
+
+				var p Problem
+				is.NoErr(json.Unmarshal([]byte(tc.Problem), &p))
+				is.Equal(p.E(), tc.E)
+			})
+		}
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		is := is.New(t)
+
+		is.Equal(E{Code: NotFound}.Problem().Status, http.StatusNotFound)
+	})
+}
+
+func TestAcceptsProblem(t *testing.T) {
+	tests := []struct {
+		Accept string
+		Want   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", false},
+		{"application/problem+json", true},
+		{"application/problem+json, application/json", true},
+		{"application/json, application/problem+json;q=0.5", false},
+		{"application/json;q=0.5, application/problem+json", true},
+		{"application/problem+json;q=0", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Accept, func(t *testing.T) {
+			is := is.New(t)
+
+			is.Equal(AcceptsProblem(tc.Accept), tc.Want)
+		})
+	}
+}
@@ -166,6 +166,21 @@ func Set(ctx context.Context, log *logrus.Entry) context.Context {
 	return context.WithValue(ctx, loggerKey, NewContextLogger(log))
 }
 
+// Fork returns a context with a copy of the ContextLogger in ctx, so fields
+// and errors can be set for concurrent work without affecting the original.
+// The context is returned unchanged if it has no ContextLogger.
+func Fork(ctx context.Context) context.Context {
+	ctxLogger := getContextLogger(ctx)
+	if ctxLogger == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, loggerKey, &ContextLogger{
+		entry:            ctxLogger.entry,
+		timeoutsAsErrors: ctxLogger.timeoutsAsErrors,
+	})
+}
+
 // Get retrieves the logrus Entry from the ContextLogger in a context
 // and returns a new logrus Entry if none is found
 func Get(ctx context.Context) *logrus.Entry {
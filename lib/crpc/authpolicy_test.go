@@ -0,0 +1,101 @@
+package crpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+)
+
+func denyAll(next HandlerFunc) HandlerFunc {
+	return func(http.ResponseWriter, *Request) error {
+		return cher.New(cher.AccessDenied, nil)
+	}
+}
+
+func TestRequireAuthPolicies(t *testing.T) {
+	noop := func(context.Context) error { return nil }
+
+	tests := []struct {
+		name   string
+		allow  bool
+		opts   []RegisterOption
+		status int
+	}{
+		{"Missing", false, nil, 0},
+		{"MiddlewareOnly", false, []RegisterOption{MiddlewareFunc(addHeaderMiddleware("X-Test", "1"))}, 0},
+		{"MissingAllowed", true, nil, http.StatusNoContent},
+		{"Policy", false, []RegisterOption{WithAuthPolicy("nobody", denyAll)}, http.StatusForbidden},
+		{"Public", false, []RegisterOption{Public()}, http.StatusNoContent},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+
+			rpc := NewServer(UnsafeNoAuthentication)
+			rpc.AllowMissingAuthPolicies = test.allow
+
+			if test.status == 0 {
+				defer func() {
+					is.True(recover() != nil)
+				}()
+			}
+
+			rpc.RegisterWithOptions("foo", "2019-01-01", nil, noop, test.opts...)
+
+			is.True(test.status != 0) // registration should have panicked
+
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/2019-01-01/foo", strings.NewReader(""))
+
+			rpc.ServeHTTP(rec, r)
+
+			is.Equal(rec.Code, test.status)
+		})
+	}
+}
+
+func TestAuthPolicyConflict(t *testing.T) {
+	is := is.New(t)
+
+	defer func() {
+		is.True(recover() != nil)
+	}()
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.RegisterWithOptions("foo", "2019-01-01", nil, func(context.Context) error { return nil }, Public(), WithAuthPolicy("nobody", denyAll))
+}
+
+func TestAuthPolicy(t *testing.T) {
+	is := is.New(t)
+
+	noop := func(context.Context) error { return nil }
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.RegisterWithOptions("open", "2019-01-01", nil, noop, Public())
+	rpc.RegisterWithOptions("closed", "2019-01-01", nil, noop, WithAuthPolicy("nobody", denyAll))
+
+	for method, status := range map[string]int{"open": http.StatusNoContent, "closed": http.StatusForbidden} {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/2019-01-01/"+method, strings.NewReader(""))
+
+		rpc.ServeHTTP(rec, r)
+
+		is.Equal(rec.Code, status)
+	}
+
+	is.Equal(rpc.Introspect().Versions[0].Methods, []IntrospectionMethod{
+		{Method: "closed", ResolvedVersion: "2019-01-01", AuthPolicy: "nobody"},
+		{Method: "open", ResolvedVersion: "2019-01-01", AuthPolicy: PublicAuthPolicy},
+	})
+
+	doc, err := rpc.OpenAPI(t.Context())
+	is.NoErr(err)
+	is.Equal(doc.Paths["/2019-01-01/closed"].Post.AuthPolicy, "nobody")
+	is.Equal(doc.Paths["/2019-01-01/open"].Post.AuthPolicy, PublicAuthPolicy)
+}
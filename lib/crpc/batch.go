@@ -0,0 +1,305 @@
+package crpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wearemojo/mojo-public-go/lib/bodycontext"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/clog"
+	"github.com/wearemojo/mojo-public-go/lib/errgroup"
+	"github.com/wearemojo/mojo-public-go/lib/merr"
+	"github.com/wearemojo/mojo-public-go/lib/mlog"
+)
+
+// BatchMethod is the method name batches are requested with, e.g.
+// `/2019-01-01/_batch`. It can't collide with registered methods, as method
+// names must start with a letter.
+const BatchMethod = "_batch"
+
+// BatchRequest is the body of a batch request. Calls are executed in order
+// unless Parallel is set.
+type BatchRequest struct {
+	Parallel bool               `json:"parallel"`
+	Calls    []BatchRequestCall `json:"calls"`
+}
+
+type BatchRequestCall struct {
+	Method string          `json:"method"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// BatchResponse contains the result of each call in the same order as the
+// calls of the BatchRequest.
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// BatchResult is the outcome of a single call. Error is set when the call
+// failed, otherwise Body contains its response (if any). Header has the
+// response headers the call set, such as Deprecation or Retry-After, as they
+// would have been sent had it been requested individually.
+type BatchResult struct {
+	Status int             `json:"status"`
+	Header http.Header     `json:"header,omitempty"`
+	Body   json.RawMessage `json:"body"`
+	Error  *cher.E         `json:"error"`
+}
+
+// EnableBatch adds the `/<version>/_batch` route, which executes multiple
+// calls against the same version in one HTTP request. Each call runs through
+// the same middleware as if it was requested individually, including
+// authentication and validation. Parallel batches execute at most maxParallel
+// calls at a time.
+func (s *Server) EnableBatch(maxCalls, maxParallel int) {
+	if maxCalls < 1 || maxParallel < 1 {
+		panic("batch limits must be positive")
+	}
+
+	s.batchMaxCalls = maxCalls
+	s.batchMaxParallel = maxParallel
+}
+
+func (s *Server) serveBatch(res http.ResponseWriter, req *Request) error {
+	ctx := req.Context()
+
+	var batch BatchRequest
+	if req.Body == nil {
+		return cher.New(cher.BadRequest, nil, cher.New("missing_request_body", nil))
+	}
+
+	if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+		return err
+	}
+
+	if len(batch.Calls) == 0 {
+		return cher.New(cher.BadRequest, nil, cher.New("batch_empty", nil))
+	} else if len(batch.Calls) > s.batchMaxCalls {
+		return cher.New(cher.BadRequest, nil, cher.New("batch_too_large", cher.M{
+			"calls":     len(batch.Calls),
+			"max_calls": s.batchMaxCalls,
+		}))
+	}
+
+	results := make([]BatchResult, len(batch.Calls))
+
+	limit := 1
+	if batch.Parallel {
+		limit = s.batchMaxParallel
+	}
+
+	g := errgroup.WithContext(ctx)
+	g.SetLimit(limit)
+
+	for idx, call := range batch.Calls {
+		g.Go(func(context.Context) error {
+			results[idx] = s.serveBatchCall(req, idx, call)
+			return nil
+		})
+	}
+
+	_ = g.Wait() // calls never fail the group, their errors are in the results
+
+	enc := json.NewEncoder(res)
+	enc.SetEscapeHTML(false)
+
+	return enc.Encode(BatchResponse{Results: results})
+}
+
+func (s *Server) serveBatchCall(parent *Request, idx int, call BatchRequestCall) BatchResult {
+	if call.Method == BatchMethod {
+		return s.batchErrorResult(parent, cher.New(cher.BadRequest, nil, cher.New("batch_nested", nil)))
+	}
+
+	// streamed responses can't be buffered into a single result
+	if handler := s.resolvedMethods[parent.Version][call.Method]; handler != nil && handler.streams() {
+		return s.batchErrorResult(parent, cher.New(cher.BadRequest, nil, cher.New("batch_stream_unsupported", cher.M{"method": call.Method})))
+	}
+
+	var body []byte
+	if len(call.Body) > 0 && !bytes.Equal(call.Body, []byte("null")) {
+		body = call.Body
+	}
+
+	if limit := s.maxBodySize(parent.Version, call.Method); limit > 0 && int64(len(body)) > limit {
+		return s.batchErrorResult(parent, requestTooLarge(limit))
+	}
+
+	req := &Request{
+		Version: parent.Version,
+		Method:  call.Method,
+
+		Body: io.NopCloser(bytes.NewReader(body)),
+
+		RemoteAddr:    parent.RemoteAddr,
+		BrowserOrigin: parent.BrowserOrigin,
+	}
+
+	// calls may run concurrently, so each gets its own logger
+	ctx := clog.Fork(parent.Context())
+	ctx = setRequestContext(ctx, req)
+	ctx = bodycontext.SetContext(ctx, body)
+	req.originalRequest = parent.originalRequest.WithContext(ctx)
+
+	// each call gets its own idempotency key, derived from the key of the batch,
+	// so calls don't collide with each other but the batch can still be retried
+	if key := parent.originalRequest.Header.Get(IdempotencyKeyHeader); key != "" {
+		req.originalRequest.Header = req.originalRequest.Header.Clone()
+		req.originalRequest.Header.Set(IdempotencyKeyHeader, key+"/"+strconv.Itoa(idx))
+	}
+
+	w := &batchResponseWriter{header: http.Header{}}
+
+	if err := coerceTimeout(ctx, s.Serve(w, req)); err != nil {
+		logBatchCallError(ctx, call.Method, err)
+
+		result := s.batchErrorResult(parent, err)
+		result.Header = w.resultHeader()
+
+		return result
+	}
+
+	result := BatchResult{Status: w.status, Header: w.resultHeader()}
+	if result.Status == 0 {
+		result.Status = http.StatusOK
+	}
+
+	if w.body.Len() > 0 {
+		if !json.Valid(w.body.Bytes()) {
+			return s.batchErrorResult(parent, cher.New("batch_response_not_json", cher.M{"method": call.Method}))
+		}
+
+		result.Body = bytes.TrimSpace(w.body.Bytes())
+	}
+
+	return result
+}
+
+// logBatchCallError logs failed calls, as the request logger only covers the
+// batch as a whole
+func logBatchCallError(ctx context.Context, method string, err error) {
+	logErr := merr.New(ctx, "crpc_batch_call_failed", merr.M{"method": method}, err)
+
+	switch clog.DetermineLevel(err, false) { //nolint:exhaustive // remaining levels are logged as info
+	case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+		mlog.Error(ctx, logErr)
+	case logrus.WarnLevel:
+		mlog.Warn(ctx, logErr)
+	default:
+		mlog.Info(ctx, logErr)
+	}
+}
+
+func (s *Server) batchErrorResult(parent *Request, err error) BatchResult {
+	body := s.localizeError(parent.originalRequest, errorBody(err))
+
+	return BatchResult{
+		Status: body.StatusCode(),
+		Error:  &body,
+	}
+}
+
+// batchResponseWriter buffers the response of a single call of a batch
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *batchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *batchResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+// resultHeader returns the headers of the call for its result, leaving out
+// those describing the body, as it is embedded in the batch response
+func (w *batchResponseWriter) resultHeader() http.Header {
+	header := w.header.Clone()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+
+	if len(header) == 0 {
+		return nil
+	}
+
+	return header
+}
+
+// BatchCall is a single call made by Client.Batch. Dst is populated with the
+// response of a successful call, otherwise Err is set. Header has the response
+// headers of the call either way.
+type BatchCall struct {
+	Method string
+	Src    any
+	Dst    any
+
+	Header http.Header
+	Err    error
+}
+
+// Batch executes multiple calls against a version in a single request. An
+// error is only returned when the batch as a whole fails, while the outcome
+// of each call is set on its Err.
+func (c *Client) Batch(ctx context.Context, version string, parallel bool, calls []BatchCall, requestModifiers ...func(r *http.Request)) error {
+	batch := BatchRequest{
+		Parallel: parallel,
+		Calls:    make([]BatchRequestCall, len(calls)),
+	}
+
+	for idx, call := range calls {
+		batch.Calls[idx].Method = call.Method
+
+		if call.Src != nil {
+			body, err := json.Marshal(call.Src)
+			if err != nil {
+				return ClientTransportError{call.Method, version, "could not marshal", err}
+			}
+
+			batch.Calls[idx].Body = body
+		}
+	}
+
+	var res BatchResponse
+	if err := c.Do(ctx, BatchMethod, version, batch, &res, requestModifiers...); err != nil {
+		return err
+	}
+
+	if len(res.Results) != len(calls) {
+		return ClientTransportError{BatchMethod, version, "unexpected number of results", nil}
+	}
+
+	for idx, result := range res.Results {
+		calls[idx].Header = result.Header
+
+		switch {
+		case result.Error != nil:
+			calls[idx].Err = *result.Error
+		case calls[idx].Dst == nil:
+			calls[idx].Err = nil
+		case len(result.Body) == 0 || bytes.Equal(result.Body, []byte("null")):
+			calls[idx].Err = ClientTransportError{calls[idx].Method, version, "no response to unmarshal to body", nil}
+		default:
+			if err := json.Unmarshal(result.Body, calls[idx].Dst); err != nil {
+				calls[idx].Err = ClientTransportError{calls[idx].Method, version, "could not unmarshal", err}
+			} else {
+				calls[idx].Err = nil
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package crpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/sirupsen/logrus"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/clog"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+type batchTestRequest struct {
+	Name string `json:"name"`
+}
+
+type batchTestResponse struct {
+	Greeting string `json:"greeting"`
+}
+
+func batchTestServer() *Server {
+	schema := gojsonschema.NewStringLoader(`{
+		"type": "object",
+		"additionalProperties": false,
+		"required": ["name"],
+		"properties": {
+			"name": {"type": "string", "minLength": 1}
+		}
+	}`)
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.EnableBatch(10, 2)
+	rpc.Register("greet", "2019-01-01", schema, func(_ context.Context, req *batchTestRequest) (*batchTestResponse, error) {
+		return &batchTestResponse{Greeting: "hello " + req.Name}, nil
+	})
+	rpc.Register("ping", "2019-01-01", nil, func(context.Context) error {
+		return nil
+	})
+
+	return rpc
+}
+
+func TestBatch(t *testing.T) {
+	for _, parallel := range []bool{false, true} {
+		t.Run(map[bool]string{false: "Sequential", true: "Parallel"}[parallel], func(t *testing.T) {
+			is := is.New(t)
+			ctx := t.Context()
+
+			srv := httptest.NewServer(batchTestServer())
+			defer srv.Close()
+
+			client := NewClient(ctx, srv.URL, nil)
+
+			var alice, bob batchTestResponse
+			calls := []BatchCall{
+				{Method: "greet", Src: &batchTestRequest{Name: "alice"}, Dst: &alice},
+				{Method: "greet", Src: &batchTestRequest{}, Dst: &bob},
+				{Method: "ping"},
+				{Method: "missing"},
+				{Method: BatchMethod},
+			}
+
+			err := client.Batch(ctx, "2019-01-01", parallel, calls)
+			is.NoErr(err)
+
+			is.NoErr(calls[0].Err)
+			is.Equal(alice.Greeting, "hello alice")
+
+			is.Equal(calls[1].Err.(cher.E).Code, cher.BadRequest) //nolint:errorlint,forcetypeassert // required for test
+			is.NoErr(calls[2].Err)
+			is.Equal(calls[3].Err.(cher.E).Code, cher.NotFound)   //nolint:errorlint,forcetypeassert // required for test
+			is.Equal(calls[4].Err.(cher.E).Code, cher.BadRequest) //nolint:errorlint,forcetypeassert // required for test
+
+			is.Equal(calls[0].Header.Get(InfraEndpointStatus), StableNotice) // each call has its own headers
+		})
+	}
+}
+
+func TestBatchLimits(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	body := `{"calls":[` + strings.Repeat(`{"method":"ping"},`, 10) + `{"method":"ping"}]}`
+
+	rec := httptest.NewRecorder()
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/2019-01-01/_batch", strings.NewReader(body))
+
+	batchTestServer().ServeHTTP(rec, r)
+
+	is.Equal(rec.Code, http.StatusBadRequest)
+	is.True(strings.Contains(rec.Body.String(), `"batch_too_large"`))
+
+	rec = httptest.NewRecorder()
+	r, _ = http.NewRequestWithContext(ctx, http.MethodPost, "/2019-01-01/_batch", strings.NewReader(`{"calls":[]}`))
+
+	batchTestServer().ServeHTTP(rec, r)
+
+	is.Equal(rec.Code, http.StatusBadRequest)
+	is.True(strings.Contains(rec.Body.String(), `"batch_empty"`))
+}
+
+func TestBatchDisabled(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("ping", "2019-01-01", nil, func(context.Context) error { return nil })
+
+	rec := httptest.NewRecorder()
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/2019-01-01/_batch", strings.NewReader(`{"calls":[{"method":"ping"}]}`))
+
+	rpc.ServeHTTP(rec, r)
+
+	is.Equal(rec.Code, http.StatusNotFound)
+}
+
+func TestBatchHeaders(t *testing.T) {
+	is := is.New(t)
+
+	rpc := batchTestServer()
+	rpc.Register("busy", "2019-01-01", nil, func(context.Context) error {
+		return cher.New(cher.TooManyRequests, nil)
+	}, addHeaderMiddleware("Retry-After", "30"))
+	rpc.Deprecate("2019-01-01", Deprecation{DeprecatedAt: time.Now().Add(-time.Hour)}, "ping")
+
+	ctx := clog.Set(t.Context(), logrus.NewEntry(logrus.New()))
+
+	rec := httptest.NewRecorder()
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/2019-01-01/_batch", strings.NewReader(`{"calls":[{"method":"ping"},{"method":"busy"}]}`))
+
+	rpc.ServeHTTP(rec, r)
+
+	var res BatchResponse
+	is.NoErr(json.Unmarshal(rec.Body.Bytes(), &res))
+	is.Equal(len(res.Results), 2)
+
+	is.True(res.Results[0].Header.Get("Deprecation") != "")
+	is.Equal(res.Results[0].Header.Get(InfraEndpointStatus), DeprecatedNotice)
+
+	is.Equal(res.Results[1].Status, http.StatusTooManyRequests)
+	is.Equal(res.Results[1].Header.Get("Retry-After"), "30")
+	is.Equal(res.Results[1].Header.Get("Content-Type"), "") // bodies are embedded in the batch response
+}
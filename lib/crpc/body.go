@@ -0,0 +1,136 @@
+package crpc
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+)
+
+// maxBodySize returns the request body size limit of a method, or zero if it
+// has none
+func (s *Server) maxBodySize(version, method string) int64 {
+	if handler := s.resolvedMethods[version][method]; handler != nil && handler.opts.maxBodySize > 0 {
+		return handler.opts.maxBodySize
+	}
+
+	return s.MaxBodySize
+}
+
+func requestTooLarge(limit int64) cher.E {
+	return cher.New(cher.RequestTooLarge, cher.M{"max_body_size": limit})
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// unknownFieldsError returns an error in the same shape as
+// CoerceJSONSchemaError listing every field of a JSON body which typ doesn't
+// have, by its full path, or nil if there are none.
+func unknownFieldsError(typ reflect.Type, body []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		// the body is decoded into typ as well, which reports the error
+		return nil
+	}
+
+	paths := unknownFields(typ, value, nil)
+	if len(paths) == 0 {
+		return nil
+	}
+
+	reasons := make([]cher.E, len(paths))
+	for i, path := range paths {
+		field := path[len(path)-1]
+
+		reasons[i] = cher.E{
+			Code: "schema_failure",
+			Meta: cher.M{
+				"field":   strings.Join(path, "."),
+				"type":    "additional_property_not_allowed",
+				"message": fmt.Sprintf("Additional property %s is not allowed", field),
+			},
+		}
+	}
+
+	return cher.New(cher.BadRequest, nil, reasons...)
+}
+
+// unknownFields walks a decoded JSON value alongside the type it is decoded
+// into, returning the path of every object key the type has no field for
+func unknownFields(typ reflect.Type, value any, path []string) [][]string {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	// types decoding themselves decide which fields they accept
+	if reflect.PointerTo(typ).Implements(jsonUnmarshalerType) || reflect.PointerTo(typ).Implements(textUnmarshalerType) {
+		return nil
+	}
+
+	var unknown [][]string
+
+	switch v := value.(type) {
+	case map[string]any:
+		switch typ.Kind() { //nolint:exhaustive // other kinds fail to decode from an object
+		case reflect.Struct:
+			fields := jsonFields(typ)
+
+			for _, key := range slices.Sorted(maps.Keys(v)) {
+				keyPath := append(slices.Clone(path), key)
+
+				field, ok := matchJSONField(fields, key)
+				if !ok {
+					unknown = append(unknown, keyPath)
+					continue
+				}
+
+				unknown = append(unknown, unknownFields(field.typ, v[key], keyPath)...)
+			}
+
+		case reflect.Map:
+			for _, key := range slices.Sorted(maps.Keys(v)) {
+				unknown = append(unknown, unknownFields(typ.Elem(), v[key], append(slices.Clone(path), key))...)
+			}
+		}
+
+	case []any:
+		if typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+			for i, elem := range v {
+				unknown = append(unknown, unknownFields(typ.Elem(), elem, append(slices.Clone(path), strconv.Itoa(i)))...)
+			}
+		}
+	}
+
+	return unknown
+}
+
+// matchJSONField finds the field encoding/json decodes a key into, preferring
+// an exact match over a case-insensitive one
+func matchJSONField(fields []jsonField, key string) (jsonField, bool) {
+	for _, f := range fields {
+		if f.name == key {
+			return f, true
+		}
+	}
+
+	for _, f := range fields {
+		if strings.EqualFold(f.name, key) {
+			return f, true
+		}
+	}
+
+	return jsonField{}, false
+}
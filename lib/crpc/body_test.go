@@ -0,0 +1,180 @@
+package crpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+type bodyTestRequest struct {
+	Name string `json:"name"`
+}
+
+func bodyTestServer() *Server {
+	echo := func(_ context.Context, req *bodyTestRequest) (*bodyTestRequest, error) {
+		return req, nil
+	}
+
+	// the schema allows unknown fields so decoding is what rejects them
+	schema := gojsonschema.NewStringLoader(`{"type": "object"}`)
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.EnableBatch(10, 2)
+	rpc.MaxBodySize = 32
+	rpc.Register("echo", "2019-01-01", schema, echo)
+	rpc.RegisterWithOptions("echo_small", "2019-01-01", schema, echo, WithMaxBodySize(16))
+	rpc.RegisterWithOptions("echo_strict", "2019-01-01", schema, echo, WithStrictDecoding())
+
+	return rpc
+}
+
+func serveBodyTest(rpc *Server, method, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/2019-01-01/"+method, strings.NewReader(body))
+
+	rpc.ServeHTTP(rec, r)
+
+	return rec
+}
+
+func TestMaxBodySize(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+		limit  float64
+	}{
+		{"WithinServerLimit", "echo", `{"name":"abcdefgh"}`, http.StatusOK, 0},
+		{"OverServerLimit", "echo", `{"name":"abcdefghijklmnopqrstuvwxyz"}`, http.StatusRequestEntityTooLarge, 32},
+		{"OverMethodLimit", "echo_small", `{"name":"abcdefgh"}`, http.StatusRequestEntityTooLarge, 16},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+
+			rec := serveBodyTest(bodyTestServer(), test.method, test.body)
+			is.Equal(rec.Code, test.status)
+
+			if test.status == http.StatusOK {
+				return
+			}
+
+			var body cher.E
+			is.NoErr(json.Unmarshal(rec.Body.Bytes(), &body))
+			is.Equal(body.Code, cher.RequestTooLarge)
+			is.Equal(body.Meta["max_body_size"], test.limit)
+		})
+	}
+}
+
+func TestMaxBodySizeBatch(t *testing.T) {
+	is := is.New(t)
+
+	rpc := bodyTestServer()
+	rpc.MaxBodySize = 0
+
+	rec := serveBodyTest(rpc, BatchMethod, `{"calls":[
+		{"method":"echo_small","body":{"name":"a"}},
+		{"method":"echo_small","body":{"name":"abcdefghijklmnop"}}
+	]}`)
+	is.Equal(rec.Code, http.StatusOK)
+
+	var res BatchResponse
+	is.NoErr(json.Unmarshal(rec.Body.Bytes(), &res))
+	is.Equal(len(res.Results), 2)
+	is.Equal(res.Results[0].Status, http.StatusOK)
+	is.Equal(res.Results[1].Status, http.StatusRequestEntityTooLarge)
+	is.Equal(res.Results[1].Error.Code, cher.RequestTooLarge)
+}
+
+func TestStrictDecoding(t *testing.T) {
+	is := is.New(t)
+
+	rec := serveBodyTest(bodyTestServer(), "echo", `{"name":"a","extra":true}`)
+	is.Equal(rec.Code, http.StatusOK)
+
+	rec = serveBodyTest(bodyTestServer(), "echo_strict", `{"name":"a","extra":true}`)
+	is.Equal(rec.Code, http.StatusBadRequest)
+
+	var body cher.E
+	is.NoErr(json.Unmarshal(rec.Body.Bytes(), &body))
+	is.Equal(body, cher.E{
+		Code: cher.BadRequest,
+		Reasons: []cher.E{{
+			Code: "schema_failure",
+			Meta: cher.M{
+				"field":   "extra",
+				"type":    "additional_property_not_allowed",
+				"message": "Additional property extra is not allowed",
+			},
+		}},
+	})
+
+	rpc := bodyTestServer()
+	rpc.StrictDecoding = true
+
+	rec = serveBodyTest(rpc, "echo", `{"name":"a","extra":true}`)
+	is.Equal(rec.Code, http.StatusBadRequest)
+}
+
+type unknownFieldsTestBase struct {
+	ID   string `json:"id"`
+	Note string
+}
+
+type unknownFieldsTestTag struct {
+	Key string `json:"key"`
+}
+
+type unknownFieldsTestRequest struct {
+	unknownFieldsTestBase
+
+	Name string                          `json:"name"`
+	Tags []unknownFieldsTestTag          `json:"tags"`
+	Meta map[string]unknownFieldsTestTag `json:"meta"`
+	At   time.Time                       `json:"at"`
+	Any  any                             `json:"any"`
+}
+
+func TestUnknownFields(t *testing.T) {
+	is := is.New(t)
+
+	body := `{
+		"id": "1", "note": "promoted and case-insensitive", "name": "a", "extra": 1,
+		"tags": [{"key": "a"}, {"key": "b", "value": "c"}],
+		"meta": {"x": {"key": "a", "other": true}},
+		"at": "2019-01-01T00:00:00Z",
+		"any": {"anything": "goes"}
+	}`
+
+	err := unknownFieldsError(reflect.TypeFor[unknownFieldsTestRequest](), []byte(body))
+
+	cerr, ok := errors.AsType[cher.E](err)
+	is.True(ok)
+	is.Equal(cerr.Code, cher.BadRequest)
+
+	fields := make([]any, len(cerr.Reasons))
+	for i, reason := range cerr.Reasons {
+		is.Equal(reason.Code, "schema_failure")
+		is.Equal(reason.Meta["type"], "additional_property_not_allowed")
+		fields[i] = reason.Meta["field"]
+	}
+
+	is.Equal(fields, []any{"extra", "meta.x.other", "tags.1.value"})
+	is.Equal(cerr.Reasons[1].Meta["message"], "Additional property other is not allowed")
+
+	is.NoErr(unknownFieldsError(reflect.TypeFor[unknownFieldsTestRequest](), []byte(`{"name":"a"}`)))
+}
@@ -0,0 +1,327 @@
+package crpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/merr"
+	"github.com/wearemojo/mojo-public-go/lib/mlog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// CircuitState is the state of a circuit of a CircuitBreaker.
+type CircuitState string
+
+const (
+	// CircuitClosed allows calls through, counting consecutive failures.
+	CircuitClosed CircuitState = "closed"
+
+	// CircuitOpen rejects calls with cher.CircuitOpen until the open timeout
+	// has passed.
+	CircuitOpen CircuitState = "open"
+
+	// CircuitHalfOpen allows a limited number of trial calls through, which
+	// decide whether the circuit closes or opens again.
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitBreakerPolicy configures the thresholds of a CircuitBreaker.
+type CircuitBreakerPolicy struct {
+	// FailureThreshold is the number of consecutive failures which opens a
+	// circuit. Defaults to 5.
+	FailureThreshold int
+
+	// OpenTimeout is how long a circuit stays open before trial calls are
+	// allowed through. Defaults to 30s.
+	OpenTimeout time.Duration
+
+	// HalfOpenMaxCalls is the number of trial calls allowed through at once
+	// while a circuit is half-open. Defaults to 1.
+	HalfOpenMaxCalls int
+
+	// SuccessThreshold is the number of successful trial calls which closes a
+	// half-open circuit. Defaults to 1.
+	SuccessThreshold int
+}
+
+const (
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitOpenTimeout      = 30 * time.Second
+	defaultCircuitHalfOpenMaxCalls = 1
+	defaultCircuitSuccessThreshold = 1
+)
+
+func (p CircuitBreakerPolicy) withDefaults() CircuitBreakerPolicy {
+	if p.FailureThreshold <= 0 {
+		p.FailureThreshold = defaultCircuitFailureThreshold
+	}
+	if p.OpenTimeout <= 0 {
+		p.OpenTimeout = defaultCircuitOpenTimeout
+	}
+	if p.HalfOpenMaxCalls <= 0 {
+		p.HalfOpenMaxCalls = defaultCircuitHalfOpenMaxCalls
+	}
+	if p.SuccessThreshold <= 0 {
+		p.SuccessThreshold = defaultCircuitSuccessThreshold
+	}
+
+	return p
+}
+
+// CircuitBreaker stops calls to a method of a service once it keeps failing,
+// giving it time to recover rather than piling more calls onto it. Each base
+// URL and method has its own circuit, so a breaker can be shared by clients.
+//
+// Transport errors, timeouts and 5xx responses count as failures, while other
+// errors are considered part of normal operation.
+//
+// State changes are logged with mlog.Warn and recorded as OpenTelemetry
+// metrics using the global MeterProvider:
+//
+//   - crpc.client.circuit.transitions (counter), labelled with the new state
+//   - crpc.client.circuit.rejections (counter)
+type CircuitBreaker struct {
+	policy CircuitBreakerPolicy
+
+	mu       sync.Mutex
+	circuits map[circuitKey]*circuit
+
+	transitions metric.Int64Counter
+	rejections  metric.Int64Counter
+}
+
+type circuitKey struct {
+	baseURL, method string
+}
+
+type circuit struct {
+	state     CircuitState
+	failures  int
+	successes int
+	trials    int
+	openedAt  time.Time
+}
+
+// NewCircuitBreaker returns a CircuitBreaker with every circuit closed.
+func NewCircuitBreaker(policy CircuitBreakerPolicy) *CircuitBreaker {
+	meter := otel.Meter(instrumentationName)
+
+	return &CircuitBreaker{
+		policy:   policy.withDefaults(),
+		circuits: map[circuitKey]*circuit{},
+
+		transitions: mustInstrument(meter.Int64Counter("crpc.client.circuit.transitions",
+			metric.WithDescription("Number of circuit breaker state changes"),
+			metric.WithUnit("{transition}"),
+		)),
+		rejections: mustInstrument(meter.Int64Counter("crpc.client.circuit.rejections",
+			metric.WithDescription("Number of calls rejected by an open circuit"),
+			metric.WithUnit("{call}"),
+		)),
+	}
+}
+
+// State returns the state of the circuit of a method of the service at baseURL.
+func (b *CircuitBreaker) State(baseURL, method string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.circuits[circuitKey{baseURL, method}]; ok {
+		return c.state
+	}
+
+	return CircuitClosed
+}
+
+// allow checks whether a call may be made, returning a function to record its
+// outcome with if so
+func (b *CircuitBreaker) allow(ctx context.Context, baseURL, method string) (func(ctx context.Context, err error, status int), error) {
+	key := circuitKey{baseURL, method}
+
+	b.mu.Lock()
+
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{state: CircuitClosed}
+		b.circuits[key] = c
+	}
+
+	var changed *circuitTransition
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= b.policy.OpenTimeout {
+		changed = b.transition(key, c, CircuitHalfOpen)
+	}
+
+	rejected := c.state == CircuitOpen || (c.state == CircuitHalfOpen && c.trials >= b.policy.HalfOpenMaxCalls)
+
+	trial := !rejected && c.state == CircuitHalfOpen
+	if trial {
+		c.trials++
+	}
+
+	b.mu.Unlock()
+
+	b.report(ctx, changed)
+
+	if rejected {
+		b.rejections.Add(ctx, 1, metric.WithAttributes(circuitAttributes(key)...))
+
+		return nil, cher.New(cher.CircuitOpen, cher.M{"base_url": baseURL, "method": method})
+	}
+
+	return func(ctx context.Context, err error, status int) {
+		b.report(ctx, b.record(ctx, key, trial, err, status))
+	}, nil
+}
+
+// record updates the circuit with the outcome of a call, returning the change
+// of state it caused, if any
+func (b *CircuitBreaker) record(ctx context.Context, key circuitKey, trial bool, err error, status int) *circuitTransition {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuits[key]
+	if trial {
+		c.trials--
+	}
+
+	// calls given up on by the caller say nothing about the service
+	if err != nil && ctx.Err() != nil {
+		return nil
+	}
+
+	failed := isCircuitFailure(err, status)
+
+	switch c.state {
+	case CircuitClosed:
+		if !failed {
+			c.failures = 0
+			return nil
+		}
+
+		c.failures++
+		if c.failures >= b.policy.FailureThreshold {
+			return b.transition(key, c, CircuitOpen)
+		}
+
+	case CircuitHalfOpen:
+		if !trial {
+			return nil
+		}
+
+		if failed {
+			return b.transition(key, c, CircuitOpen)
+		}
+
+		c.successes++
+		if c.successes >= b.policy.SuccessThreshold {
+			return b.transition(key, c, CircuitClosed)
+		}
+
+	case CircuitOpen:
+		// calls started before the circuit opened don't change it
+	}
+
+	return nil
+}
+
+// circuitTransition is a change of state of a circuit, reported once the
+// breaker is unlocked so logging doesn't hold up other calls
+type circuitTransition struct {
+	key      circuitKey
+	from, to CircuitState
+	failures int
+}
+
+// transition changes the state of a circuit, which must be done with the
+// breaker locked
+func (b *CircuitBreaker) transition(key circuitKey, c *circuit, state CircuitState) *circuitTransition {
+	t := &circuitTransition{key: key, from: c.state, to: state, failures: c.failures}
+
+	c.state = state
+	c.failures = 0
+	c.successes = 0
+
+	if state == CircuitOpen {
+		c.openedAt = time.Now()
+	}
+
+	return t
+}
+
+// report logs and counts a change of state, if there was one
+func (b *CircuitBreaker) report(ctx context.Context, t *circuitTransition) {
+	if t == nil {
+		return
+	}
+
+	mlog.Warn(ctx, merr.New(ctx, "crpc_circuit_state_changed", merr.M{
+		"base_url": t.key.baseURL,
+		"method":   t.key.method,
+		"from":     t.from,
+		"to":       t.to,
+		"failures": t.failures,
+	}))
+
+	b.transitions.Add(ctx, 1, metric.WithAttributes(append(circuitAttributes(t.key),
+		attribute.String("crpc.circuit.state", string(t.to)),
+	)...))
+}
+
+func circuitAttributes(key circuitKey) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("rpc.system", "crpc"),
+		attribute.String("rpc.method", key.method),
+		attribute.String("server.address", key.baseURL),
+	}
+}
+
+// isCircuitFailure reports whether a call failed in a way which suggests the
+// service is unhealthy
+func isCircuitFailure(err error, status int) bool {
+	if err == nil {
+		return false
+	}
+
+	if status >= http.StatusInternalServerError {
+		return true
+	}
+
+	if cerr, ok := errors.AsType[cher.E](err); ok {
+		return cerr.Code == cher.RequestTimeout
+	}
+
+	return isTransportFailure(err)
+}
+
+// UseCircuitBreaker checks calls made with Do and Stream against breaker,
+// failing them with cher.CircuitOpen while the circuit of the method is open.
+// With a RetryPolicy, each attempt of Do is checked and recorded separately,
+// while a stream is recorded once it ends.
+func (c *Client) UseCircuitBreaker(breaker *CircuitBreaker) {
+	c.breaker = breaker
+	c.recordResponses()
+}
+
+func (c *Client) attemptWithBreaker(ctx context.Context, method, version string, src, dst any, requestModifiers []func(r *http.Request)) error {
+	done, err := c.breaker.allow(ctx, c.baseURL, method)
+	if err != nil {
+		return err
+	}
+
+	res, ok := ctx.Value(recordedResponseKey).(*recordedResponse)
+	if !ok {
+		res = &recordedResponse{}
+		ctx = context.WithValue(ctx, recordedResponseKey, res)
+	}
+
+	err = c.send(ctx, method, version, src, dst, requestModifiers)
+	done(ctx, err, res.status)
+
+	return err
+}
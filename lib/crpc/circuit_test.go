@@ -0,0 +1,244 @@
+package crpc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/sirupsen/logrus"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/clog"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// circuitTestServer responds to every call with the status in status
+func circuitTestServer(t *testing.T, status *atomic.Int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		switch code := int(status.Load()); code {
+		case http.StatusOK:
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"message":"pong"}`))
+		case http.StatusBadRequest:
+			w.WriteHeader(code)
+			_, _ = w.Write([]byte(`{"code":"invalid_thing"}`))
+		default:
+			w.WriteHeader(code)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &calls
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+
+	srv, calls := circuitTestServer(t, &status)
+
+	breaker := NewCircuitBreaker(CircuitBreakerPolicy{
+		FailureThreshold: 2,
+		OpenTimeout:      20 * time.Millisecond,
+	})
+
+	client := NewClient(ctx, srv.URL, nil)
+	client.UseCircuitBreaker(breaker)
+
+	call := func(method string) error {
+		return client.Do(ctx, method, "2019-01-01", nil, &testResponse{})
+	}
+
+	is.True(call("ping") != nil)
+	is.Equal(breaker.State(srv.URL, "ping"), CircuitClosed)
+	is.True(call("ping") != nil)
+	is.Equal(breaker.State(srv.URL, "ping"), CircuitOpen)
+
+	// open circuits reject calls without making them
+	err := call("ping")
+	cerr, ok := err.(cher.E) //nolint:errorlint // required for test
+	is.True(ok)
+	is.Equal(cerr.Code, cher.CircuitOpen)
+	is.Equal(cerr.StatusCode(), http.StatusServiceUnavailable)
+	is.Equal(calls.Load(), int32(2))
+
+	// other methods have their own circuit
+	is.True(call("pong") != nil)
+	is.Equal(calls.Load(), int32(3))
+	is.Equal(breaker.State(srv.URL, "pong"), CircuitClosed)
+
+	// a failed trial call opens the circuit again
+	time.Sleep(25 * time.Millisecond)
+	is.True(call("ping") != nil)
+	is.Equal(calls.Load(), int32(4))
+	is.Equal(breaker.State(srv.URL, "ping"), CircuitOpen)
+
+	// a successful trial call closes it
+	status.Store(http.StatusOK)
+	time.Sleep(25 * time.Millisecond)
+	is.NoErr(call("ping"))
+	is.Equal(breaker.State(srv.URL, "ping"), CircuitClosed)
+}
+
+// hookFunc is a logrus hook calling a function for every entry
+type hookFunc func(*logrus.Entry)
+
+func (hookFunc) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h hookFunc) Fire(entry *logrus.Entry) error {
+	h(entry)
+	return nil
+}
+
+func TestCircuitBreakerLogsUnlocked(t *testing.T) {
+	is := is.New(t)
+
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+
+	srv, _ := circuitTestServer(t, &status)
+
+	breaker := NewCircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 1})
+
+	// logging a state change must not hold up calls checking the breaker
+	var logged CircuitState
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(hookFunc(func(*logrus.Entry) {
+		logged = breaker.State(srv.URL, "ping")
+	}))
+
+	ctx := clog.Set(t.Context(), logrus.NewEntry(logger))
+
+	client := NewClient(ctx, srv.URL, nil)
+	client.UseCircuitBreaker(breaker)
+
+	done := make(chan error)
+	go func() {
+		done <- client.Do(ctx, "ping", "2019-01-01", nil, &testResponse{})
+	}()
+
+	select {
+	case err := <-done:
+		is.True(err != nil)
+	case <-time.After(5 * time.Second):
+		t.Fatal("call deadlocked while the state change was logged")
+	}
+
+	is.Equal(logged, CircuitOpen)
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	var status atomic.Int32
+	status.Store(http.StatusBadRequest)
+
+	srv, _ := circuitTestServer(t, &status)
+
+	breaker := NewCircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 1})
+
+	client := NewClient(ctx, srv.URL, nil)
+	client.UseCircuitBreaker(breaker)
+
+	for range 3 {
+		err := client.Do(ctx, "ping", "2019-01-01", nil, &testResponse{})
+		cerr, ok := err.(cher.E) //nolint:errorlint // required for test
+		is.True(ok)
+		is.Equal(cerr.Code, "invalid_thing")
+	}
+
+	is.Equal(breaker.State(srv.URL, "ping"), CircuitClosed)
+}
+
+func TestCircuitBreakerMetrics(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(provider)
+	defer otel.SetMeterProvider(previous)
+
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+
+	srv, _ := circuitTestServer(t, &status)
+
+	client := NewClient(ctx, srv.URL, nil)
+	client.UseCircuitBreaker(NewCircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 1}))
+
+	for range 2 {
+		_ = client.Do(ctx, "ping", "2019-01-01", nil, nil)
+	}
+
+	var rm metricdata.ResourceMetrics
+	is.NoErr(reader.Collect(ctx, &rm))
+
+	sums := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok {
+				for _, dp := range sum.DataPoints {
+					sums[m.Name] += dp.Value
+				}
+			}
+		}
+	}
+
+	is.Equal(sums["crpc.client.circuit.transitions"], int64(1))
+	is.Equal(sums["crpc.client.circuit.rejections"], int64(1))
+}
+
+func TestCircuitBreakerStream(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+
+	srv, calls := circuitTestServer(t, &status)
+
+	breaker := NewCircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 1})
+
+	client := NewClient(ctx, srv.URL, nil)
+	client.UseCircuitBreaker(breaker)
+
+	stream := func() (errs []error) {
+		for _, err := range client.Stream(ctx, "count", "2019-01-01", nil) {
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		return errs
+	}
+
+	is.Equal(len(stream()), 1)
+	is.Equal(breaker.State(srv.URL, "count"), CircuitOpen)
+
+	errs := stream()
+	is.Equal(len(errs), 1)
+
+	cerr, ok := errs[0].(cher.E) //nolint:errorlint // required for test
+	is.True(ok)
+	is.Equal(cerr.Code, cher.CircuitOpen)
+	is.Equal(calls.Load(), int32(1))
+}
@@ -1,9 +1,14 @@
 package crpc
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"iter"
+	"mime"
 	"net/http"
 	"path"
 
@@ -21,6 +26,13 @@ const (
 // variables/structs and the authenticated round tripper live there.
 type Client struct {
 	client *jsonclient.Client
+
+	baseURL string
+
+	codec        Codec
+	retry        *RetryPolicy
+	breaker      *CircuitBreaker
+	internalAuth bool
 }
 
 // NewClient returns a client configured with a transport scheme, remote host
@@ -35,13 +47,208 @@ func NewClient(ctx context.Context, baseURL string, c *http.Client) *Client {
 		jcc.UserAgent = fmt.Sprintf(userAgentTemplate, version.Truncated)
 	}
 
-	return &Client{jcc}
+	return &Client{client: jcc, baseURL: baseURL}
+}
+
+// UseCodec sends request bodies in the format of codec, and asks for
+// responses in it too. Servers which haven't registered the codec respond
+// with JSON, which is still accepted.
+func (c *Client) UseCodec(codec Codec) {
+	c.codec = codec
 }
 
-// Do executes an RPC request against the configured server.
+// Do executes an RPC request against the configured server, retrying it if
+// a RetryPolicy is in use.
 func (c *Client) Do(ctx context.Context, method, version string, src, dst any, requestModifiers ...func(r *http.Request)) error {
-	err := c.client.Do(ctx, "POST", path.Join(version, method), nil, src, dst, requestModifiers...)
+	if c.retry != nil {
+		return c.doWithRetry(ctx, method, version, src, dst, requestModifiers)
+	}
+
+	return c.attempt(ctx, method, version, src, dst, requestModifiers)
+}
+
+// attempt makes a single attempt at an RPC request, unless the circuit of the
+// method is open
+func (c *Client) attempt(ctx context.Context, method, version string, src, dst any, requestModifiers []func(r *http.Request)) error {
+	if c.breaker != nil {
+		return c.attemptWithBreaker(ctx, method, version, src, dst, requestModifiers)
+	}
+
+	return c.send(ctx, method, version, src, dst, requestModifiers)
+}
+
+func (c *Client) send(ctx context.Context, method, version string, src, dst any, requestModifiers []func(r *http.Request)) error {
+	headers := http.Header{}
+	setTimeoutHeader(ctx, headers)
+
+	if c.internalAuth {
+		if err := setInternalAuthHeader(ctx, headers); err != nil {
+			return err
+		}
+	}
+
+	if c.codec != nil {
+		return wrapTransportError(method, version, c.doWithCodec(ctx, method, version, headers, src, dst, requestModifiers))
+	}
+
+	err := c.client.DoWithHeaders(ctx, "POST", path.Join(version, method), headers, nil, src, dst, requestModifiers...)
+
+	return wrapTransportError(method, version, err)
+}
+
+func (c *Client) doWithCodec(ctx context.Context, method, version string, headers http.Header, src, dst any, requestModifiers []func(r *http.Request)) error {
+	headers.Set("Accept", c.codec.ContentType()+", "+jsonContentType+";q=0.9")
+
+	if src != nil {
+		data, err := json.Marshal(src)
+		if err != nil {
+			return ClientTransportError{method, version, "could not marshal", err}
+		}
+
+		body, err := transcodeToCodec(c.codec, data)
+		if err != nil {
+			return ClientTransportError{method, version, "could not marshal", err}
+		}
+
+		// jsonclient only sets a body for a non-nil src, so it is set here
+		// instead, before any other modifiers run
+		requestModifiers = append([]func(r *http.Request){func(r *http.Request) {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+			r.ContentLength = int64(len(body))
+			r.Header.Set("Content-Type", c.codec.ContentType())
+		}}, requestModifiers...)
+	}
+
+	return c.client.DoWithHandler(ctx, "POST", path.Join(version, method), headers, nil, nil, func(res *http.Response) error {
+		if dst == nil {
+			return nil
+		}
+
+		data, err := io.ReadAll(res.Body)
+		if err != nil {
+			return ClientTransportError{method, version, "could not read response body stream", err}
+		}
+
+		if len(data) == 0 {
+			return jsonclient.ErrNoResponse
+		}
+
+		if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mediaType == c.codec.ContentType() {
+			data, err = transcodeFromCodec(c.codec, data)
+			if err != nil {
+				return ClientTransportError{method, version, "could not unmarshal", err}
+			}
+		}
+
+		if err := json.Unmarshal(data, dst); err != nil {
+			return ClientTransportError{method, version, "could not unmarshal", err}
+		}
+
+		return nil
+	}, requestModifiers...)
+}
+
+// Stream executes an RPC request against a method with a streamed response,
+// yielding each item as it is received. A stream cut short, before the server
+// marks its end, yields a ClientTransportError. With a CircuitBreaker, the
+// stream is checked and recorded as a single call, while a RetryPolicy doesn't
+// apply. The http.Client used must not have a timeout shorter than the
+// expected duration of the stream.
+func (c *Client) Stream(ctx context.Context, method, version string, src any, requestModifiers ...func(r *http.Request)) iter.Seq2[json.RawMessage, error] {
+	return func(yield func(json.RawMessage, error) bool) {
+		var stopped bool
+
+		headers := http.Header{"Accept": []string{ContentTypeNDJSON}}
+		setTimeoutHeader(ctx, headers)
+
+		if c.internalAuth {
+			if err := setInternalAuthHeader(ctx, headers); err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+
+		// the whole stream counts as a single call to the breaker, and isn't
+		// retried as items may already have been yielded
+		if c.breaker != nil {
+			done, err := c.breaker.allow(ctx, c.baseURL, method)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			res := &recordedResponse{}
+			ctx = context.WithValue(ctx, recordedResponseKey, res)
+
+			var streamErr error
+			defer func() { done(ctx, streamErr, res.status) }()
+
+			yield = recordStreamError(yield, &streamErr)
+		}
+
+		err := c.client.DoWithHandler(ctx, "POST", path.Join(version, method), headers, nil, src, func(res *http.Response) error {
+			dec := json.NewDecoder(res.Body)
+
+			for {
+				var line StreamLine
+				err := dec.Decode(&line)
+				if errors.Is(err, io.EOF) {
+					return ClientTransportError{method, version, "stream ended unexpectedly", io.ErrUnexpectedEOF}
+				} else if err != nil {
+					return ClientTransportError{method, version, "could not unmarshal", err}
+				}
+
+				if line.Error != nil {
+					return *line.Error
+				} else if line.Done {
+					return nil
+				}
+
+				if !yield(line.Item, nil) {
+					stopped = true
+					return nil
+				}
+			}
+		}, requestModifiers...)
+
+		if err != nil && !stopped {
+			yield(nil, wrapTransportError(method, version, err))
+		}
+	}
+}
+
+// recordStreamError wraps the yield function of a stream to keep the error
+// ending it, if any
+func recordStreamError(yield func(json.RawMessage, error) bool, streamErr *error) func(json.RawMessage, error) bool {
+	return func(item json.RawMessage, err error) bool {
+		if err != nil {
+			*streamErr = err
+		}
+
+		return yield(item, err)
+	}
+}
+
+// Stream is the same as Client.Stream, however it decodes each item into T.
+func Stream[T any](ctx context.Context, c *Client, method, version string, src any, requestModifiers ...func(r *http.Request)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for raw, err := range c.Stream(ctx, method, version, src, requestModifiers...) {
+			var item T
+			if err == nil {
+				if err = json.Unmarshal(raw, &item); err != nil {
+					err = ClientTransportError{method, version, "could not unmarshal", err}
+				}
+			}
+
+			if !yield(item, err) || err != nil {
+				return
+			}
+		}
+	}
+}
 
+func wrapTransportError(method, version string, err error) error {
 	if err == nil {
 		return nil
 	}
@@ -0,0 +1,311 @@
+package crpc
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/merr"
+	"github.com/wearemojo/mojo-public-go/lib/mlog"
+)
+
+// Codec is a wire format request and response bodies can be negotiated in,
+// as an alternative to JSON. Bodies are transcoded to and from JSON at the
+// edge of the server, so schema validation, middleware and handlers always
+// see the JSON equivalent of a body. Errors and streamed responses are always
+// sent as JSON.
+type Codec interface {
+	// ContentType is the media type the codec is negotiated with.
+	ContentType() string
+
+	// Marshal encodes a value produced by decoding JSON, made up of maps with
+	// string keys, slices, strings, int64s, float64s, bools and nil.
+	Marshal(v any) ([]byte, error)
+
+	// Unmarshal decodes data into a value which can be encoded as JSON.
+	Unmarshal(data []byte) (any, error)
+}
+
+var (
+	// MessagePack is a Codec using the `application/msgpack` media type.
+	MessagePack Codec = messagePackCodec{}
+
+	// CBOR is a Codec using the `application/cbor` media type.
+	CBOR Codec = cborCodec{}
+)
+
+type messagePackCodec struct{}
+
+func (messagePackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (messagePackCodec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (messagePackCodec) Unmarshal(data []byte) (v any, err error) {
+	err = msgpack.Unmarshal(data, &v)
+	return v, err
+}
+
+type cborCodec struct{}
+
+var cborDecMode = func() cbor.DecMode {
+	mode, err := cbor.DecOptions{
+		DefaultMapType: reflect.TypeFor[map[string]any](),
+	}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+
+	return mode
+}()
+
+func (cborCodec) ContentType() string {
+	return "application/cbor"
+}
+
+func (cborCodec) Marshal(v any) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+func (cborCodec) Unmarshal(data []byte) (v any, err error) {
+	err = cborDecMode.Unmarshal(data, &v)
+	return v, err
+}
+
+// RegisterCodec allows request and response bodies to be sent in the format of
+// codec, as negotiated by the Content-Type and Accept request headers. JSON is
+// always supported and used by default.
+func (s *Server) RegisterCodec(codec Codec) {
+	s.codecs = append(s.codecs, codec)
+}
+
+// requestCodec returns the registered codec of the Content-Type of a request,
+// or nil for JSON and unrecognised types
+func (s *Server) requestCodec(r *http.Request) Codec {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil
+	}
+
+	for _, codec := range s.codecs {
+		if codec.ContentType() == mediaType {
+			return codec
+		}
+	}
+
+	return nil
+}
+
+// responseCodec returns the registered codec the client prefers, or nil if it
+// prefers JSON or accepts none of them
+func (s *Server) responseCodec(r *http.Request) Codec {
+	for _, mediaType := range acceptedMediaTypes(r.Header.Get("Accept")) {
+		if mediaType == jsonContentType {
+			return nil
+		}
+
+		for _, codec := range s.codecs {
+			if codec.ContentType() == mediaType {
+				return codec
+			}
+		}
+	}
+
+	return nil
+}
+
+// acceptedMediaTypes returns the media ranges of an Accept header from most to
+// least preferred, by quality and then the order they are listed in, leaving
+// out those with a quality of zero, which are not acceptable
+func acceptedMediaTypes(accept string) []string {
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+
+	var ranges []mediaRange
+
+	for accepted := range strings.SplitSeq(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		if q > 0 {
+			ranges = append(ranges, mediaRange{mediaType, q})
+		}
+	}
+
+	slices.SortStableFunc(ranges, func(a, b mediaRange) int {
+		return cmp.Compare(b.q, a.q)
+	})
+
+	mediaTypes := make([]string, len(ranges))
+	for i, r := range ranges {
+		mediaTypes[i] = r.mediaType
+	}
+
+	return mediaTypes
+}
+
+// decodeRequestBody transcodes a request body in the format of codec to JSON
+func decodeRequestBody(r *http.Request, codec Codec) (io.ReadCloser, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, merr.New(r.Context(), "request_body_read_failed", nil, err)
+	}
+
+	if len(data) > 0 {
+		data, err = transcodeFromCodec(codec, data)
+		if err != nil {
+			return nil, cher.New("invalid_body", cher.M{"content_type": codec.ContentType(), "error": err.Error()})
+		}
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func transcodeFromCodec(codec Codec, data []byte) ([]byte, error) {
+	v, err := codec.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+func transcodeToCodec(codec Codec, data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	} else if dec.More() {
+		return nil, errors.New("unexpected data after json value")
+	}
+
+	return codec.Marshal(normalizeJSONNumbers(v))
+}
+
+// normalizeJSONNumbers replaces json.Numbers with int64s where possible, and
+// float64s otherwise, so codecs encode them as numbers rather than strings
+func normalizeJSONNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+
+		n, _ := v.Float64()
+		return n
+
+	case map[string]any:
+		for key, val := range v {
+			v[key] = normalizeJSONNumbers(val)
+		}
+
+	case []any:
+		for idx, val := range v {
+			v[idx] = normalizeJSONNumbers(val)
+		}
+	}
+
+	return v
+}
+
+// codecResponseWriter transcodes successful JSON responses to a codec once the
+// response is complete. Errors and other content types are written as normal.
+type codecResponseWriter struct {
+	http.ResponseWriter
+
+	codec Codec
+
+	decided   bool
+	buffering bool
+	status    int
+	body      bytes.Buffer
+}
+
+func (w *codecResponseWriter) decide(status int) {
+	if w.decided {
+		return
+	}
+
+	w.decided = true
+	w.status = status
+
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	w.buffering = status < http.StatusBadRequest && mediaType == jsonContentType
+
+	if !w.buffering {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *codecResponseWriter) WriteHeader(status int) {
+	w.decide(status)
+}
+
+func (w *codecResponseWriter) Write(b []byte) (int, error) {
+	w.decide(http.StatusOK)
+
+	if w.buffering {
+		return w.body.Write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *codecResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes the transcoded response, falling back to JSON if it can't be
+// transcoded, which clients must accept
+func (w *codecResponseWriter) finish(req *http.Request) {
+	if !w.buffering {
+		return
+	}
+
+	ctx := req.Context()
+
+	body := w.body.Bytes()
+
+	if len(bytes.TrimSpace(body)) > 0 {
+		data, err := transcodeToCodec(w.codec, body)
+		if err != nil {
+			mlog.Warn(ctx, merr.New(ctx, "crpc_response_transcode_failed", merr.M{"content_type": w.codec.ContentType()}, err))
+		} else {
+			body = data
+			w.Header().Set("Content-Type", w.codec.ContentType())
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	if _, err := w.ResponseWriter.Write(body); err != nil {
+		mlog.Warn(ctx, merr.New(ctx, "crpc_response_write_failed", nil, err))
+	}
+}
@@ -0,0 +1,141 @@
+package crpc
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+type codecTestRequest struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type codecTestResponse struct {
+	Greeting string   `json:"greeting"`
+	Counts   []int    `json:"counts"`
+	Ratio    float64  `json:"ratio"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+func codecTestServer() *Server {
+	schema := gojsonschema.NewStringLoader(`{
+		"type": "object",
+		"additionalProperties": false,
+		"required": ["name", "count"],
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"count": {"type": "integer"}
+		}
+	}`)
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.RegisterCodec(MessagePack)
+	rpc.RegisterCodec(CBOR)
+	rpc.Register("greet", "2019-01-01", schema, func(_ context.Context, req *codecTestRequest) (*codecTestResponse, error) {
+		counts := make([]int, req.Count)
+		for idx := range counts {
+			counts[idx] = idx
+		}
+
+		return &codecTestResponse{Greeting: "hello " + req.Name, Counts: counts, Ratio: 0.5}, nil
+	})
+
+	return rpc
+}
+
+func TestCodec(t *testing.T) {
+	for _, codec := range []Codec{MessagePack, CBOR} {
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			is := is.New(t)
+			ctx := t.Context()
+
+			srv := httptest.NewServer(codecTestServer())
+			defer srv.Close()
+
+			client := NewClient(ctx, srv.URL, nil)
+			client.UseCodec(codec)
+
+			var res codecTestResponse
+			err := client.Do(ctx, "greet", "2019-01-01", &codecTestRequest{Name: "mojo", Count: 3}, &res)
+			is.NoErr(err)
+			is.Equal(res, codecTestResponse{Greeting: "hello mojo", Counts: []int{0, 1, 2}, Ratio: 0.5})
+
+			// the request is validated against its JSON equivalent
+			err = client.Do(ctx, "greet", "2019-01-01", &codecTestRequest{Count: 3}, &res)
+			cerr, ok := err.(cher.E) //nolint:errorlint // required for test
+			is.True(ok)
+			is.Equal(cerr.Code, cher.BadRequest)
+		})
+	}
+}
+
+func TestCodecNegotiation(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	body, err := msgpack.Marshal(map[string]any{"name": "mojo", "count": 1})
+	is.NoErr(err)
+
+	rec := httptest.NewRecorder()
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/2019-01-01/greet", bytes.NewReader(body))
+	r.Header.Set("Content-Type", MessagePack.ContentType())
+	r.Header.Set("Accept", "application/cbor, application/json;q=0.9")
+
+	codecTestServer().ServeHTTP(rec, r)
+
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Header().Get("Content-Type"), CBOR.ContentType())
+
+	res, err := CBOR.Unmarshal(rec.Body.Bytes())
+	is.NoErr(err)
+	is.Equal(res.(map[string]any)["greeting"], "hello mojo") //nolint:forcetypeassert // required for test
+
+	// responses are JSON unless a codec is accepted
+	rec = httptest.NewRecorder()
+	r, _ = http.NewRequestWithContext(ctx, http.MethodPost, "/2019-01-01/greet", bytes.NewReader(body))
+	r.Header.Set("Content-Type", MessagePack.ContentType())
+
+	codecTestServer().ServeHTTP(rec, r)
+
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Header().Get("Content-Type"), "application/json; charset=utf-8")
+}
+
+func TestCodecQuality(t *testing.T) {
+	tests := []struct {
+		accept      string
+		contentType string
+	}{
+		{"application/cbor, application/json;q=0.9", "application/cbor"},
+		{"application/cbor;q=0.5, application/json", "application/json; charset=utf-8"},
+		{"application/json;q=0.5, application/msgpack;q=0.8, application/cbor;q=0.9", "application/cbor"},
+		{"application/cbor;q=0, application/msgpack", "application/msgpack"},
+		{"application/cbor;q=0", "application/json; charset=utf-8"},
+		{"application/msgpack, application/cbor", "application/msgpack"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.accept, func(t *testing.T) {
+			is := is.New(t)
+
+			rec := httptest.NewRecorder()
+			r, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, "/2019-01-01/greet", strings.NewReader(`{"name":"mojo","count":1}`))
+			r.Header.Set("Accept", test.accept)
+
+			codecTestServer().ServeHTTP(rec, r)
+
+			is.Equal(rec.Code, http.StatusOK)
+			is.Equal(rec.Header().Get("Content-Type"), test.contentType)
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Package crpccontract provides consumer-driven contract tests for crpc
+// services, without any network.
+//
+// Consumers record the calls their tests make to a service with a Recorder,
+// saving them as a golden file. A Replayer serves the recorded responses in
+// place of the service, and the provider's test suite runs Verify against its
+// crpc.Server to check it still honours every recorded call.
+package crpccontract
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+)
+
+// Contract is the set of calls a consumer makes to a service.
+type Contract struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded call and its response. Error is set instead of
+// Response when the call failed with a cher error.
+type Interaction struct {
+	Method  string          `json:"method"`
+	Version string          `json:"version"`
+	Request json.RawMessage `json:"request,omitempty"`
+
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    *cher.E         `json:"error,omitempty"`
+}
+
+// Load reads a contract from a golden file. A missing file is an empty
+// contract.
+func Load(filename string) (*Contract, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Contract{Interactions: []Interaction{}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var contract Contract
+	if err := json.Unmarshal(data, &contract); err != nil {
+		return nil, err
+	}
+
+	return &contract, nil
+}
+
+// Save writes the contract to a golden file, creating its directory if needed.
+func (c *Contract) Save(filename string) error {
+	data, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil { //nolint:mnd // standard directory permissions
+		return err
+	}
+
+	return os.WriteFile(filename, append(data, '\n'), 0o644) //nolint:gosec,mnd // golden files are not secret
+}
+
+// Find returns the interaction recorded for a call, matching request bodies
+// by their JSON value rather than their formatting.
+func (c *Contract) Find(method, version string, request []byte) (Interaction, bool) {
+	key := canonicalJSON(request)
+
+	for _, interaction := range c.Interactions {
+		if interaction.Method == method && interaction.Version == version && canonicalJSON(interaction.Request) == key {
+			return interaction, true
+		}
+	}
+
+	return Interaction{}, false
+}
+
+// add records an interaction, replacing any recorded for the same call
+func (c *Contract) add(interaction Interaction) {
+	key := canonicalJSON(interaction.Request)
+
+	for idx, existing := range c.Interactions {
+		if existing.Method == interaction.Method && existing.Version == interaction.Version && canonicalJSON(existing.Request) == key {
+			c.Interactions[idx] = interaction
+			return
+		}
+	}
+
+	c.Interactions = append(c.Interactions, interaction)
+}
+
+// canonicalJSON formats a JSON value consistently, with object keys sorted
+func canonicalJSON(data []byte) string {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || string(data) == "null" {
+		return ""
+	}
+
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return string(data)
+	}
+
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return string(data)
+	}
+
+	return string(canonical)
+}
+
+// requestPath returns the method and version of a crpc request path, which
+// may be preceded by the prefix of the client's base URL
+func requestPath(urlPath string) (method, version string, ok bool) {
+	dir, method := path.Split(strings.TrimSuffix(urlPath, "/"))
+	_, version = path.Split(strings.TrimSuffix(dir, "/"))
+
+	return method, version, method != "" && version != ""
+}
@@ -0,0 +1,134 @@
+package crpccontract
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/wearemojo/mojo-public-go/lib/authenforce"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/crpc"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+type greetRequest struct {
+	Name string `json:"name"`
+}
+
+type greetResponse struct {
+	Greeting string   `json:"greeting"`
+	Tags     []string `json:"tags"`
+}
+
+func providerServer() *crpc.Server {
+	schema := gojsonschema.NewStringLoader(`{
+		"type": "object",
+		"required": ["name"],
+		"properties": {"name": {"type": "string"}}
+	}`)
+
+	rpc := crpc.NewServer(authenforce.CRPCMiddleware(authenforce.Enforcers{authenforce.UnsafeNoAuthentication}))
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("greet", "2019-01-01", schema, func(_ context.Context, req *greetRequest) (*greetResponse, error) {
+		if req.Name == "" {
+			return nil, cher.New("name_required", nil)
+		}
+
+		return &greetResponse{Greeting: "hello " + req.Name, Tags: []string{"friendly"}}, nil
+	})
+
+	return rpc
+}
+
+func TestRecordReplayVerify(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	srv := httptest.NewServer(providerServer())
+
+	recorder := NewRecorder(nil)
+	client := crpc.NewClient(ctx, srv.URL, &http.Client{Transport: recorder})
+
+	var res greetResponse
+	is.NoErr(client.Do(ctx, "greet", "2019-01-01", greetRequest{Name: "alice"}, &res))
+	is.Equal(res.Greeting, "hello alice")
+
+	err := client.Do(ctx, "greet", "2019-01-01", greetRequest{}, &res)
+	is.Equal(err.(cher.E).Code, "name_required") //nolint:errorlint,forcetypeassert // required for test
+
+	srv.Close()
+
+	filename := filepath.Join(t.TempDir(), "contracts", "greeter.json")
+	is.NoErr(recorder.Save(filename))
+
+	contract, err := Load(filename)
+	is.NoErr(err)
+	is.Equal(len(contract.Interactions), 2)
+	is.Equal(contract.Interactions[0].Method, "greet")
+	is.Equal(contract.Interactions[0].Version, "2019-01-01")
+	is.Equal(contract.Interactions[0].Status, http.StatusOK)
+	is.Equal(contract.Interactions[1].Status, http.StatusBadRequest)
+	is.Equal(contract.Interactions[1].Error.Code, "name_required")
+
+	// the consumer's tests run against the recording
+	replayed := crpc.NewClient(ctx, "http://greeter.invalid", &http.Client{Transport: NewReplayer(contract)})
+
+	res = greetResponse{}
+	is.NoErr(replayed.Do(ctx, "greet", "2019-01-01", greetRequest{Name: "alice"}, &res))
+	is.Equal(res.Greeting, "hello alice")
+
+	err = replayed.Do(ctx, "greet", "2019-01-01", greetRequest{}, &res)
+	is.Equal(err.(cher.E).Code, "name_required") //nolint:errorlint,forcetypeassert // required for test
+
+	err = replayed.Do(ctx, "greet", "2019-01-01", greetRequest{Name: "bob"}, &res)
+	_, ok := err.(crpc.ClientTransportError) //nolint:errorlint // required for test
+	is.True(ok)
+
+	// and the provider's tests check it still holds
+	Verify(ctx, t, providerServer(), contract)
+}
+
+func TestCheckInteraction(t *testing.T) {
+	recorded := Interaction{
+		Status:   http.StatusOK,
+		Response: json.RawMessage(`{"greeting":"hello","tags":["a"],"meta":{"count":1}}`),
+	}
+
+	failed := Interaction{
+		Status: http.StatusBadRequest,
+		Error:  &cher.E{Code: "name_required"},
+	}
+
+	tests := []struct {
+		name        string
+		interaction Interaction
+		status      int
+		body        string
+		err         error
+		ok          bool
+	}{
+		{"Same", recorded, http.StatusOK, `{"greeting":"hi","tags":["b","c"],"meta":{"count":2}}`, nil, true},
+		{"ExtraField", recorded, http.StatusOK, `{"greeting":"hi","tags":[],"meta":{"count":2},"new":true}`, nil, true},
+		{"MissingField", recorded, http.StatusOK, `{"greeting":"hi","tags":[]}`, nil, false},
+		{"ChangedType", recorded, http.StatusOK, `{"greeting":"hi","tags":[],"meta":{"count":"2"}}`, nil, false},
+		{"ChangedItemType", recorded, http.StatusOK, `{"greeting":"hi","tags":[1],"meta":{"count":2}}`, nil, false},
+		{"Null", recorded, http.StatusOK, `{"greeting":null,"tags":[],"meta":{"count":2}}`, nil, false},
+		{"NowFails", recorded, http.StatusBadRequest, ``, cher.New("nope", nil), false},
+		{"SameError", failed, http.StatusBadRequest, ``, cher.New("name_required", nil), true},
+		{"OtherError", failed, http.StatusBadRequest, ``, cher.New("nope", nil), false},
+		{"NowSucceeds", failed, http.StatusOK, `{}`, nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+
+			err := checkInteraction(test.interaction, test.status, []byte(test.body), test.err)
+			is.Equal(err == nil, test.ok)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package crpccontract
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+)
+
+// Recorder is an http.RoundTripper recording the calls made through it into
+// a contract. Give it to the http.Client of a crpc.Client in the consumer's
+// tests, then Save the contract once they have run.
+//
+// Only JSON responses are recorded, so streamed responses are not.
+type Recorder struct {
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	contract *Contract
+}
+
+// NewRecorder returns a Recorder making calls with next, or
+// http.DefaultTransport if it is nil.
+func NewRecorder(next http.RoundTripper) *Recorder {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &Recorder{
+		next:     next,
+		contract: &Contract{Interactions: []Interaction{}},
+	}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var request []byte
+	if req.Body != nil {
+		var err error
+		if request, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(request))
+	}
+
+	res, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	method, version, ok := requestPath(req.URL.Path)
+	if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); !ok || mediaType != "application/json" {
+		return res, nil
+	}
+
+	response, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	res.Body = io.NopCloser(bytes.NewReader(response))
+
+	interaction := Interaction{
+		Method:  method,
+		Version: version,
+		Status:  res.StatusCode,
+	}
+
+	if len(bytes.TrimSpace(request)) > 0 {
+		interaction.Request = json.RawMessage(request)
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		cerr := cher.Coerce(response)
+		interaction.Error = &cerr
+	} else if len(bytes.TrimSpace(response)) > 0 {
+		interaction.Response = json.RawMessage(response)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.contract.add(interaction)
+
+	return res, nil
+}
+
+// Contract returns a copy of the contract recorded so far.
+func (r *Recorder) Contract() *Contract {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &Contract{Interactions: append([]Interaction{}, r.contract.Interactions...)}
+}
+
+// Save merges the recorded calls into the contract of a golden file, replacing
+// any previously recorded for the same calls.
+func (r *Recorder) Save(filename string) error {
+	contract, err := Load(filename)
+	if err != nil {
+		return err
+	}
+
+	for _, interaction := range r.Contract().Interactions {
+		contract.add(interaction)
+	}
+
+	return contract.Save(filename)
+}
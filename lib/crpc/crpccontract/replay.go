@@ -0,0 +1,71 @@
+package crpccontract
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Replayer is an http.RoundTripper serving the responses of a contract, in
+// place of the service it was recorded from. Calls which weren't recorded fail
+// with an error.
+type Replayer struct {
+	contract *Contract
+}
+
+// NewReplayer returns a Replayer serving the responses of contract.
+func NewReplayer(contract *Contract) *Replayer {
+	return &Replayer{contract: contract}
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var request []byte
+	if req.Body != nil {
+		var err error
+		if request, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+
+		req.Body.Close()
+	}
+
+	method, version, ok := requestPath(req.URL.Path)
+	if !ok {
+		return nil, fmt.Errorf("crpccontract: %s is not a crpc request path", req.URL.Path) //nolint:err113 // only seen in tests
+	}
+
+	interaction, ok := r.contract.Find(method, version, request)
+	if !ok {
+		return nil, fmt.Errorf("crpccontract: no recorded call to %s/%s with request %s", version, method, request) //nolint:err113 // only seen in tests
+	}
+
+	var body []byte
+	if interaction.Error != nil {
+		var err error
+		if body, err = json.Marshal(interaction.Error); err != nil {
+			return nil, err
+		}
+	} else {
+		body = interaction.Response
+	}
+
+	header := http.Header{}
+	if len(body) > 0 {
+		header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(interaction.Status) + " " + http.StatusText(interaction.Status),
+		StatusCode:    interaction.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
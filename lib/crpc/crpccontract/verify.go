@@ -0,0 +1,156 @@
+package crpccontract
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/crpc"
+	"github.com/wearemojo/mojo-public-go/lib/crpc/crpctest"
+)
+
+// Verify makes every call of contract against rpc in-process, as a subtest of
+// t, failing it for responses which no longer match the recorded ones. Calls
+// are made with ctx, which can carry auth state set with crpctest.WithAuthState.
+//
+// Successful responses match if they have every field of the recorded
+// response, with values of the same JSON type, so providers can add fields and
+// change values freely. Errors match if they have the same status and code.
+func Verify(ctx context.Context, t *testing.T, rpc *crpc.Server, contract *Contract) {
+	t.Helper()
+
+	srv := crpctest.NewServer(t, rpc)
+
+	for _, interaction := range contract.Interactions {
+		t.Run(interaction.Version+"/"+interaction.Method, func(t *testing.T) {
+			ctx, res := crpctest.CaptureResponse(ctx)
+
+			var src any
+			if len(interaction.Request) > 0 {
+				src = interaction.Request
+			}
+
+			var body json.RawMessage
+			var dst any
+			if len(interaction.Response) > 0 {
+				dst = &body
+			}
+
+			err := srv.Client.Do(ctx, interaction.Method, interaction.Version, src, dst)
+			if err := checkInteraction(interaction, res.StatusCode, body, err); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// checkInteraction compares the outcome of a call with its recorded one
+func checkInteraction(interaction Interaction, status int, body []byte, err error) error {
+	if interaction.Error != nil {
+		cerr, ok := errors.AsType[cher.E](err)
+		if !ok {
+			return fmt.Errorf("expected error %q, got %v", interaction.Error.Code, err) //nolint:err113 // only seen in tests
+		} else if cerr.Code != interaction.Error.Code {
+			return fmt.Errorf("expected error %q, got %q", interaction.Error.Code, cerr.Code) //nolint:err113 // only seen in tests
+		}
+	} else if err != nil {
+		return fmt.Errorf("expected success, got %v", err) //nolint:err113 // only seen in tests
+	}
+
+	if status != interaction.Status {
+		return fmt.Errorf("expected status %d, got %d", interaction.Status, status) //nolint:err113 // only seen in tests
+	}
+
+	if interaction.Error != nil || len(interaction.Response) == 0 {
+		return nil
+	}
+
+	var recorded, actual any
+	if err := json.Unmarshal(interaction.Response, &recorded); err != nil {
+		return fmt.Errorf("recorded response is invalid: %w", err)
+	}
+	if err := json.Unmarshal(body, &actual); err != nil {
+		return fmt.Errorf("response is invalid: %w", err)
+	}
+
+	return matchShape("$", recorded, actual)
+}
+
+// matchShape checks actual has every field of recorded, with values of the
+// same JSON type
+func matchShape(path string, recorded, actual any) error {
+	switch recorded := recorded.(type) {
+	case nil:
+		return nil
+
+	case map[string]any:
+		actual, ok := actual.(map[string]any)
+		if !ok {
+			return shapeMismatch(path, recorded, actual)
+		}
+
+		for key, value := range recorded {
+			field, ok := actual[key]
+			if !ok {
+				return fmt.Errorf("%s.%s: missing from response", path, key) //nolint:err113 // only seen in tests
+			}
+
+			if err := matchShape(path+"."+key, value, field); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	case []any:
+		actual, ok := actual.([]any)
+		if !ok {
+			return shapeMismatch(path, recorded, actual)
+		}
+
+		if len(recorded) == 0 {
+			return nil
+		}
+
+		for idx, item := range actual {
+			if err := matchShape(fmt.Sprintf("%s[%d]", path, idx), recorded[0], item); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	default:
+		if fmt.Sprintf("%T", recorded) != fmt.Sprintf("%T", actual) {
+			return shapeMismatch(path, recorded, actual)
+		}
+
+		return nil
+	}
+}
+
+func shapeMismatch(path string, recorded, actual any) error {
+	return fmt.Errorf("%s: expected %s, got %s", path, jsonType(recorded), jsonType(actual)) //nolint:err113 // only seen in tests
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
@@ -0,0 +1,619 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/wearemojo/mojo-public-go/lib/crpc"
+	"github.com/wearemojo/mojo-public-go/lib/merr"
+)
+
+const crpcImportPath = "github.com/wearemojo/mojo-public-go/lib/crpc"
+
+// Config describes what to generate a client from, and where to write it.
+type Config struct {
+	Dir          string
+	Interface    string
+	Registration string
+	Output       string
+	Package      string
+	Type         string
+}
+
+type registration struct {
+	rpc     string
+	version string
+	schema  ast.Expr
+}
+
+type method struct {
+	name     string
+	rpc      string
+	version  string
+	request  string
+	response string
+	schema   string
+}
+
+// generator keeps track of the imports needed by the generated file
+type generator struct {
+	imports map[string]string // path -> name
+
+	// ifaceQualifier is the name the interface package is imported with, or
+	// empty when the client is generated into the same package
+	ifaceQualifier string
+}
+
+// Generate returns the formatted source of a typed client for cfg.
+func Generate(cfg Config) ([]byte, error) {
+	ctx := context.Background()
+
+	ifaceDir, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	outDir, err := filepath.Abs(filepath.Dir(cfg.Output))
+	if err != nil {
+		return nil, err
+	}
+
+	iface, ifaceFile, err := findInterface(ctx, ifaceDir, cfg.Interface)
+	if err != nil {
+		return nil, err
+	}
+
+	ifacePath, err := importPath(ctx, ifaceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	registrations, regFile, err := parseRegistrations(cfg.Registration)
+	if err != nil {
+		return nil, err
+	}
+
+	gen := &generator{imports: map[string]string{}}
+
+	// types declared by the interface package need qualifying when the client
+	// is generated into a different package
+	if ifaceDir != outDir {
+		gen.ifaceQualifier = ifaceFile.Name.Name
+		gen.imports[ifacePath] = gen.ifaceQualifier
+	}
+
+	ifaceImports := fileImports(ifaceFile)
+	regImports := fileImports(regFile)
+
+	var methods []method
+
+	for _, field := range iface.Methods.List {
+		fnType, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) != 1 {
+			return nil, merr.New(ctx, "interface_member_unsupported", merr.M{"interface": cfg.Interface})
+		}
+
+		name := field.Names[0].Name
+
+		regs := registrations[name]
+		if len(regs) == 0 {
+			return nil, merr.New(ctx, "method_not_registered", merr.M{"method": name})
+		}
+
+		reg, err := pinRegistration(ctx, name, regs)
+		if err != nil {
+			return nil, err
+		}
+
+		m := method{
+			name:    name,
+			rpc:     reg.rpc,
+			version: reg.version,
+		}
+
+		params := flattenFields(fnType.Params)
+		results := flattenFields(fnType.Results)
+
+		if len(params) < 1 || len(params) > 2 || len(results) < 1 || len(results) > 2 {
+			return nil, merr.New(ctx, "method_signature_unsupported", merr.M{"method": name})
+		}
+
+		if len(params) == 2 {
+			if m.request, err = gen.renderType(ctx, params[1], ifaceImports); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(results) == 2 {
+			if m.response, err = gen.renderType(ctx, results[0], ifaceImports); err != nil {
+				return nil, err
+			}
+		}
+
+		if m.request != "" && reg.schema != nil {
+			m.schema = gen.renderSchema(reg.schema, ifacePath, regImports)
+		}
+
+		methods = append(methods, m)
+	}
+
+	return gen.render(cfg, methods)
+}
+
+func findInterface(ctx context.Context, dir, name string) (*ast.InterfaceType, *ast.File, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fset := token.NewFileSet()
+
+	for _, filename := range files {
+		if strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+
+		file, err := parser.ParseFile(fset, filename, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+
+			for _, spec := range gen.Specs {
+				typeSpec, ok := spec.(*ast.TypeSpec)
+				if !ok || typeSpec.Name.Name != name {
+					continue
+				}
+
+				iface, ok := typeSpec.Type.(*ast.InterfaceType)
+				if !ok {
+					return nil, nil, merr.New(ctx, "type_not_interface", merr.M{"type": name})
+				}
+
+				return iface, file, nil
+			}
+		}
+	}
+
+	return nil, nil, merr.New(ctx, "interface_not_found", merr.M{"interface": name, "dir": dir})
+}
+
+var expModule = regexp.MustCompile(`^module\s+"?([^"\s]+)"?`)
+
+// importPath determines the import path of a directory from the closest
+// go.mod file
+func importPath(ctx context.Context, dir string) (string, error) {
+	for modDir := dir; ; modDir = filepath.Dir(modDir) {
+		modulePath, err := readModulePath(ctx, filepath.Join(modDir, "go.mod"))
+		if os.IsNotExist(err) {
+			if filepath.Dir(modDir) == modDir {
+				return "", merr.New(ctx, "go_mod_not_found", merr.M{"dir": dir})
+			}
+
+			continue
+		} else if err != nil {
+			return "", err
+		}
+
+		rel, err := filepath.Rel(modDir, dir)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(modulePath, filepath.ToSlash(rel)), nil
+	}
+}
+
+func readModulePath(ctx context.Context, filename string) (string, error) {
+	file, err := os.Open(filename) //nolint:gosec // path is derived from the package directory
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if match := expModule.FindStringSubmatch(scanner.Text()); match != nil {
+			return match[1], nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", merr.New(ctx, "go_mod_missing_module", merr.M{"file": filename})
+}
+
+// parseRegistrations finds every `Register` or `RegisterWithOptions` call with a
+// method value, keyed by the name of the method
+func parseRegistrations(filename string) (map[string][]registration, *ast.File, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), filename, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	registrations := map[string][]registration{}
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok || len(call.Args) < 4 {
+			return true
+		}
+
+		if fn, ok := call.Fun.(*ast.SelectorExpr); !ok || (fn.Sel.Name != "Register" && fn.Sel.Name != "RegisterWithOptions") {
+			return true
+		}
+
+		rpc, ok := stringLiteral(call.Args[0])
+		if !ok {
+			return true
+		}
+
+		version, ok := stringLiteral(call.Args[1])
+		if !ok {
+			return true
+		}
+
+		// withdrawn methods are registered with nil, and are not method values
+		fn, ok := call.Args[3].(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+
+		var schema ast.Expr
+		if ident, ok := call.Args[2].(*ast.Ident); !ok || ident.Name != "nil" {
+			schema = call.Args[2]
+		}
+
+		registrations[fn.Sel.Name] = append(registrations[fn.Sel.Name], registration{
+			rpc:     rpc,
+			version: version,
+			schema:  schema,
+		})
+
+		return true
+	})
+
+	return registrations, file, nil
+}
+
+// pinRegistration picks the latest dated registration of a method, only
+// falling back to preview when the method has no dated version
+func pinRegistration(ctx context.Context, name string, regs []registration) (registration, error) {
+	sort.Slice(regs, func(i, j int) bool {
+		if (regs[i].version == crpc.VersionPreview) != (regs[j].version == crpc.VersionPreview) {
+			return regs[j].version == crpc.VersionPreview
+		}
+
+		return regs[i].version < regs[j].version
+	})
+
+	pinned := regs[0]
+	for _, reg := range regs {
+		if reg.rpc != pinned.rpc {
+			return pinned, merr.New(ctx, "method_registered_with_multiple_names", merr.M{
+				"method": name,
+				"names":  []string{pinned.rpc, reg.rpc},
+			})
+		}
+
+		if reg.version != crpc.VersionPreview {
+			pinned = reg
+		}
+	}
+
+	return pinned, nil
+}
+
+func stringLiteral(expr ast.Expr) (string, bool) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+
+	str, err := strconv.Unquote(lit.Value)
+	return str, err == nil
+}
+
+func flattenFields(list *ast.FieldList) []ast.Expr {
+	if list == nil {
+		return nil
+	}
+
+	var types []ast.Expr
+	for _, field := range list.List {
+		count := max(len(field.Names), 1)
+		for range count {
+			types = append(types, field.Type)
+		}
+	}
+
+	return types
+}
+
+type importSpec struct {
+	path  string
+	alias bool
+}
+
+// fileImports maps the names packages are referred to by in a file to their
+// import spec
+func fileImports(file *ast.File) map[string]importSpec {
+	imports := map[string]importSpec{}
+
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+
+		if spec.Name != nil {
+			imports[spec.Name.Name] = importSpec{importPath, true}
+			continue
+		}
+
+		imports[defaultPackageName(importPath)] = importSpec{importPath, false}
+	}
+
+	return imports
+}
+
+var expMajorVersion = regexp.MustCompile(`^v\d+$`)
+
+func defaultPackageName(importPath string) string {
+	parts := strings.Split(importPath, "/")
+	name := parts[len(parts)-1]
+
+	if expMajorVersion.MatchString(name) && len(parts) > 1 {
+		name = parts[len(parts)-2]
+	}
+
+	return strings.ReplaceAll(name, "-", "")
+}
+
+func (g *generator) addImport(name string, spec importSpec) {
+	if spec.alias {
+		g.imports[spec.path] = name
+	} else {
+		g.imports[spec.path] = ""
+	}
+}
+
+// renderType prints a type expression from the interface file so it can be
+// used from the generated package
+func (g *generator) renderType(ctx context.Context, expr ast.Expr, imports map[string]importSpec) (string, error) {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		if g.ifaceQualifier != "" && ast.IsExported(expr.Name) {
+			return g.ifaceQualifier + "." + expr.Name, nil
+		}
+
+		return expr.Name, nil
+
+	case *ast.SelectorExpr:
+		pkg, ok := expr.X.(*ast.Ident)
+		if !ok {
+			break
+		}
+
+		spec, ok := imports[pkg.Name]
+		if !ok {
+			return "", merr.New(ctx, "import_not_found", merr.M{"package": pkg.Name})
+		}
+
+		g.addImport(pkg.Name, spec)
+
+		return pkg.Name + "." + expr.Sel.Name, nil
+
+	case *ast.StarExpr:
+		elem, err := g.renderType(ctx, expr.X, imports)
+		return "*" + elem, err
+
+	case *ast.ArrayType:
+		if expr.Len != nil {
+			break
+		}
+
+		elem, err := g.renderType(ctx, expr.Elt, imports)
+		return "[]" + elem, err
+
+	case *ast.MapType:
+		key, err := g.renderType(ctx, expr.Key, imports)
+		if err != nil {
+			return "", err
+		}
+
+		value, err := g.renderType(ctx, expr.Value, imports)
+		return "map[" + key + "]" + value, err
+
+	case *ast.InterfaceType:
+		if len(expr.Methods.List) == 0 {
+			return "any", nil
+		}
+
+	case *ast.IndexListExpr:
+		// generic types, e.g. iter.Seq2[*T, error] for streamed responses
+		typ, err := g.renderType(ctx, expr.X, imports)
+		if err != nil {
+			return "", err
+		}
+
+		args := make([]string, len(expr.Indices))
+		for idx, index := range expr.Indices {
+			if args[idx], err = g.renderType(ctx, index, imports); err != nil {
+				return "", err
+			}
+		}
+
+		return typ + "[" + strings.Join(args, ", ") + "]", nil
+	}
+
+	return "", merr.New(ctx, "type_unsupported", merr.M{"type": fmt.Sprintf("%T", expr)})
+}
+
+// renderSchema prints a schema expression from the registration file, which
+// can only be referenced when it is exported by another package
+func (g *generator) renderSchema(expr ast.Expr, ifacePath string, imports map[string]importSpec) string {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+
+	spec, ok := imports[pkg.Name]
+	if !ok {
+		return ""
+	}
+
+	if spec.path == ifacePath {
+		if g.ifaceQualifier == "" {
+			return sel.Sel.Name
+		}
+
+		return g.ifaceQualifier + "." + sel.Sel.Name
+	}
+
+	g.addImport(pkg.Name, spec)
+
+	return pkg.Name + "." + sel.Sel.Name
+}
+
+func (g *generator) render(cfg Config, methods []method) ([]byte, error) {
+	g.imports["context"] = ""
+	g.imports["net/http"] = ""
+	g.imports[crpcImportPath] = ""
+
+	var buf bytes.Buffer
+
+	buf.WriteString("// Code generated by crpcgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", cfg.Package)
+
+	// standard library imports are grouped before everything else
+	var std, other []string
+	for importPath := range g.imports {
+		if first, _, _ := strings.Cut(importPath, "/"); strings.Contains(first, ".") {
+			other = append(other, importPath)
+		} else {
+			std = append(std, importPath)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+
+	buf.WriteString("import (\n")
+	for idx, group := range [][]string{std, other} {
+		if idx > 0 && len(std) > 0 && len(other) > 0 {
+			buf.WriteString("\n")
+		}
+
+		for _, importPath := range group {
+			if name := g.imports[importPath]; name != "" && name != defaultPackageName(importPath) {
+				fmt.Fprintf(&buf, "\t%s %q\n", name, importPath)
+			} else {
+				fmt.Fprintf(&buf, "\t%q\n", importPath)
+			}
+		}
+	}
+	buf.WriteString(")\n\n")
+
+	ifaceType := cfg.Interface
+	if g.ifaceQualifier != "" {
+		ifaceType = g.ifaceQualifier + "." + cfg.Interface
+	}
+
+	fmt.Fprintf(&buf, "var _ %s = (*%s)(nil)\n\n", ifaceType, cfg.Type)
+
+	for _, m := range methods {
+		if m.schema != "" {
+			fmt.Fprintf(&buf, "var %s = crpc.MustCompileSchema(%s)\n\n", schemaVar(m.name), m.schema)
+		}
+	}
+
+	fmt.Fprintf(&buf, "// %s is a typed crpc client for %s.\n", cfg.Type, cfg.Interface)
+	fmt.Fprintf(&buf, "type %s struct {\n\t*crpc.Client\n}\n\n", cfg.Type)
+
+	fmt.Fprintf(&buf, "// New%s returns a client for the service at baseURL.\n", cfg.Type)
+	fmt.Fprintf(&buf, "func New%s(ctx context.Context, baseURL string, c *http.Client) *%s {\n", cfg.Type, cfg.Type)
+	fmt.Fprintf(&buf, "\treturn &%s{crpc.NewClient(ctx, baseURL, c)}\n}\n", cfg.Type)
+
+	for _, m := range methods {
+		buf.WriteString("\n")
+		renderMethod(&buf, cfg.Type, m)
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+func renderMethod(buf *bytes.Buffer, typ string, m method) {
+	params := "ctx context.Context"
+	src := "nil"
+	if m.request != "" {
+		params += ", req " + m.request
+		src = "req"
+	}
+
+	fmt.Fprintf(buf, "// %s calls %s, pinned to version %s.\n", m.name, m.rpc, m.version)
+
+	if m.response == "" {
+		fmt.Fprintf(buf, "func (c *%s) %s(%s) error {\n", typ, m.name, params)
+
+		if m.schema != "" {
+			fmt.Fprintf(buf, "\tif err := crpc.ValidateRequest(%s, req); err != nil {\n\t\treturn err\n\t}\n\n", schemaVar(m.name))
+		}
+
+		fmt.Fprintf(buf, "\treturn c.Do(ctx, %q, %q, %s, nil)\n}\n", m.rpc, m.version, src)
+		return
+	}
+
+	if item, ok := strings.CutPrefix(m.response, "iter.Seq2["); ok {
+		item = strings.TrimSuffix(item, ", error]")
+
+		fmt.Fprintf(buf, "func (c *%s) %s(%s) (%s, error) {\n", typ, m.name, params, m.response)
+
+		if m.schema != "" {
+			fmt.Fprintf(buf, "\tif err := crpc.ValidateRequest(%s, req); err != nil {\n\t\treturn nil, err\n\t}\n\n", schemaVar(m.name))
+		}
+
+		fmt.Fprintf(buf, "\treturn crpc.Stream[%s](ctx, c.Client, %q, %q, %s), nil\n}\n", item, m.rpc, m.version, src)
+		return
+	}
+
+	fmt.Fprintf(buf, "func (c *%s) %s(%s) (res %s, err error) {\n", typ, m.name, params, m.response)
+
+	if m.schema != "" {
+		fmt.Fprintf(buf, "\tif err := crpc.ValidateRequest(%s, req); err != nil {\n\t\treturn res, err\n\t}\n\n", schemaVar(m.name))
+	}
+
+	fmt.Fprintf(buf, "\treturn res, c.Do(ctx, %q, %q, %s, &res)\n}\n", m.rpc, m.version, src)
+}
+
+func schemaVar(name string) string {
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+
+	return string(runes) + "Schema"
+}
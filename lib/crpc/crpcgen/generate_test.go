@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestGenerateExampleIsUpToDate(t *testing.T) {
+	is := is.New(t)
+
+	src, err := Generate(Config{
+		Dir:          "../example",
+		Interface:    "Service",
+		Registration: "../example/server/server.go",
+		Output:       "../example/client/client_gen.go",
+		Package:      "main",
+		Type:         "ExampleClient",
+	})
+	is.NoErr(err)
+
+	existing, err := os.ReadFile("../example/client/client_gen.go")
+	is.NoErr(err)
+
+	is.Equal(string(src), string(existing)) // run `go generate ./...` in lib/crpc/example
+}
+
+func TestGenerateSamePackage(t *testing.T) {
+	is := is.New(t)
+
+	src, err := Generate(Config{
+		Dir:          "../example",
+		Interface:    "Service",
+		Registration: "../example/server/server.go",
+		Output:       "../example/client_gen.go",
+		Package:      "example",
+		Type:         "Client",
+	})
+	is.NoErr(err)
+
+	is.True(!strings.Contains(string(src), `"github.com/wearemojo/mojo-public-go/lib/crpc/example"`))
+	is.True(strings.Contains(string(src), "var greetSchema = crpc.MustCompileSchema(GreetRequestSchema)"))
+	is.True(strings.Contains(string(src), "func (c *Client) Greet(ctx context.Context, req *GreetRequest) (res *GreetResponse, err error) {"))
+}
+
+func TestPinRegistration(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	reg, err := pinRegistration(ctx, "Foo", []registration{
+		{rpc: "foo", version: "preview"},
+		{rpc: "foo", version: "2019-02-02"},
+		{rpc: "foo", version: "2019-01-01"},
+	})
+	is.NoErr(err)
+	is.Equal(reg.version, "2019-02-02")
+
+	reg, err = pinRegistration(ctx, "Foo", []registration{
+		{rpc: "foo", version: "preview"},
+	})
+	is.NoErr(err)
+	is.Equal(reg.version, "preview")
+
+	_, err = pinRegistration(ctx, "Foo", []registration{
+		{rpc: "foo", version: "2019-01-01"},
+		{rpc: "bar", version: "2019-02-02"},
+	})
+	is.True(err != nil)
+}
+
+func TestGenerateStream(t *testing.T) {
+	is := is.New(t)
+
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"go.mod": "module example.com/svc\n",
+		"svc.go": `package svc
+
+import (
+	"context"
+	"iter"
+)
+
+type Service interface {
+	Export(context.Context) (iter.Seq2[*Item, error], error)
+}
+
+type Item struct{}
+`,
+		"server.go": `package svc
+
+func register(rpc *crpc.Server, svc Service) {
+	rpc.Register("export", "2019-01-01", nil, svc.Export)
+}
+`,
+	}
+
+	for name, content := range files {
+		is.NoErr(os.WriteFile(dir+"/"+name, []byte(content), 0o600))
+	}
+
+	src, err := Generate(Config{
+		Dir:          dir,
+		Interface:    "Service",
+		Registration: dir + "/server.go",
+		Output:       dir + "/client/client_gen.go",
+		Package:      "client",
+		Type:         "Client",
+	})
+	is.NoErr(err)
+
+	is.True(strings.Contains(string(src), "\t\"iter\"\n"))
+	is.True(strings.Contains(string(src), "\t\"example.com/svc\"\n"))
+	is.True(strings.Contains(string(src), "func (c *Client) Export(ctx context.Context) (iter.Seq2[*svc.Item, error], error) {"))
+	is.True(strings.Contains(string(src), `return crpc.Stream[*svc.Item](ctx, c.Client, "export", "2019-01-01", nil), nil`))
+}
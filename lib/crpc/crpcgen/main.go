@@ -0,0 +1,70 @@
+// crpcgen generates a typed crpc client from a service interface and the file
+// registering its methods on a crpc.Server.
+//
+// It is intended to be run with `go generate` from the package declaring the
+// interface:
+//
+//	//go:generate go run github.com/wearemojo/mojo-public-go/lib/crpc/crpcgen -interface Service -registration ./server/server.go -output ./client/client_gen.go
+//
+// Every interface method must be registered with `Register` or
+// `RegisterWithOptions` using a method value (e.g. `svc.Greet`). The generated
+// method is pinned to the latest version the method value is registered with,
+// and validates requests against the registered schema when it can be
+// referenced from the generated package.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("crpcgen: ")
+
+	var cfg Config
+
+	flag.StringVar(&cfg.Dir, "dir", ".", "directory of the package declaring the interface")
+	flag.StringVar(&cfg.Interface, "interface", "", "name of the service interface (required)")
+	flag.StringVar(&cfg.Registration, "registration", "", "file registering the service methods (required)")
+	flag.StringVar(&cfg.Output, "output", "", "file to write the generated client to (required)")
+	flag.StringVar(&cfg.Package, "package", "", "package name of the generated file (defaults to the output directory name)")
+	flag.StringVar(&cfg.Type, "type", "", "name of the generated client type (defaults to <interface>Client)")
+	flag.Parse()
+
+	if cfg.Interface == "" || cfg.Registration == "" || cfg.Output == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if cfg.Package == "" {
+		cfg.Package = filepath.Base(filepath.Dir(mustAbs(cfg.Output)))
+		cfg.Package = strings.ReplaceAll(cfg.Package, "-", "")
+	}
+
+	if cfg.Type == "" {
+		cfg.Type = cfg.Interface + "Client"
+	}
+
+	src, err := Generate(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	//nolint:gosec // generated source is not sensitive
+	if err := os.WriteFile(cfg.Output, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func mustAbs(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return abs
+}
@@ -0,0 +1,200 @@
+// Package crpctest provides utilities for testing crpc services in-process.
+//
+// Calls made through the client of a Server are handled by the crpc.Server
+// directly, without a network listener, and keep the caller's context. Auth
+// state and actors set on the context with WithAuthState and WithActor are
+// therefore seen by the server's authentication middleware and handlers, in
+// place of parsing an Authorization header.
+package crpctest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wearemojo/mojo-public-go/lib/actor"
+	"github.com/wearemojo/mojo-public-go/lib/authparsing"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/clog"
+	"github.com/wearemojo/mojo-public-go/lib/crpc"
+)
+
+// BaseURL is the URL the client of a Server is configured with. It is never
+// resolved, as requests are handled in-process.
+const BaseURL = "http://crpctest.invalid"
+
+// Server serves a crpc.Server to its Client in-process.
+type Server struct {
+	*crpc.Server
+
+	Client *crpc.Client
+}
+
+// NewServer returns a Server handling the requests of its Client with rpc.
+func NewServer(t testing.TB, rpc *crpc.Server) *Server {
+	t.Helper()
+
+	httpClient := &http.Client{
+		Transport: &transport{handler: rpc},
+	}
+
+	return &Server{
+		Server: rpc,
+
+		Client: crpc.NewClient(t.Context(), BaseURL, httpClient),
+	}
+}
+
+// WithAuthState returns a context carrying auth state, as if it had been
+// parsed from the Authorization header by authparsing.Middleware.
+func WithAuthState(ctx context.Context, state any) context.Context {
+	return authparsing.SetAuthState(ctx, state)
+}
+
+// WithActor returns a context carrying an actor, which takes priority over the
+// actor of the auth state.
+func WithActor(ctx context.Context, a actor.Actor) context.Context {
+	return actor.SetActor(ctx, a)
+}
+
+// Response is the response to a call made with a context from
+// CaptureResponse.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+}
+
+type contextKey string
+
+const responseKey contextKey = "crpctest_response"
+
+// CaptureResponse returns a context which records the response of the call it
+// is used for, for assertions on the status and headers.
+func CaptureResponse(ctx context.Context) (context.Context, *Response) {
+	res := &Response{}
+
+	return context.WithValue(ctx, responseKey, res), res
+}
+
+// transport handles requests in-process by calling handler directly
+type transport struct {
+	handler http.Handler
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	// a real server would have a request scoped logger, which crpc.Logger
+	// depends on
+	r := req.Clone(clog.Set(ctx, logrus.NewEntry(logrus.StandardLogger())))
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.RequestURI = req.URL.RequestURI()
+
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, r)
+
+	res := rec.Result()
+	res.Request = req
+
+	if captured, ok := ctx.Value(responseKey).(*Response); ok {
+		captured.StatusCode = res.StatusCode
+		captured.Header = maps.Clone(res.Header)
+	}
+
+	return res, nil
+}
+
+// AssertCode fails the test unless err is a cher error with the given code.
+func AssertCode(t testing.TB, err error, code string) {
+	t.Helper()
+
+	cerr, ok := errors.AsType[cher.E](err)
+	if !ok {
+		t.Fatalf("expected cher error %q, got %v", code, err)
+	} else if cerr.Code != code {
+		t.Fatalf("expected cher error %q, got %q", code, cerr.Code)
+	}
+}
+
+// AssertReason fails the test unless err is a cher error with a reason with
+// the given code.
+func AssertReason(t testing.TB, err error, code string) {
+	t.Helper()
+
+	cerr, ok := errors.AsType[cher.E](err)
+	if !ok {
+		t.Fatalf("expected cher error with reason %q, got %v", code, err)
+	}
+
+	for _, reason := range cerr.Reasons {
+		if reason.Code == code {
+			return
+		}
+	}
+
+	t.Fatalf("expected cher error with reason %q, got %s", code, cerr.Serialize())
+}
+
+// AssertEndpointStatus fails the test unless the response has the given
+// `Infra-Endpoint-Status` header, e.g. crpc.StableNotice.
+func AssertEndpointStatus(t testing.TB, res *Response, status string) {
+	t.Helper()
+
+	if got := res.Header.Get(crpc.InfraEndpointStatus); got != status {
+		t.Fatalf("expected %s %q, got %q", crpc.InfraEndpointStatus, status, got)
+	}
+}
+
+// AssertCompatible fails the test if the dated versions of rpc have changed in
+// ways which break clients since the snapshot in filename was taken, e.g. a
+// newly required request field or a removed method. The snapshot is written
+// when the file doesn't exist, and should be committed, then deleted to be
+// taken again after intended changes.
+func AssertCompatible(t testing.TB, rpc *crpc.Server, filename string) {
+	t.Helper()
+
+	current := rpc.Snapshot()
+
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		data, err = json.MarshalIndent(current, "", "\t")
+		if err != nil {
+			t.Fatalf("failed to marshal snapshot: %v", err)
+		}
+
+		if err := os.WriteFile(filename, append(data, '\n'), 0o644); err != nil { //nolint:gosec,mnd // snapshots are not secret
+			t.Fatalf("failed to write snapshot: %v", err)
+		}
+
+		return
+	} else if err != nil {
+		t.Fatalf("failed to read snapshot: %v", err)
+	}
+
+	var previous crpc.Snapshot
+	if err := json.Unmarshal(data, &previous); err != nil {
+		t.Fatalf("failed to unmarshal snapshot: %v", err)
+	}
+
+	for _, change := range crpc.DiffSnapshots(&previous, current) {
+		t.Errorf("breaking change: %s", change)
+	}
+}
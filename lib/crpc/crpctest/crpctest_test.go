@@ -0,0 +1,85 @@
+package crpctest_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/wearemojo/mojo-public-go/lib/actor"
+	"github.com/wearemojo/mojo-public-go/lib/authenforce"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/crpc"
+	"github.com/wearemojo/mojo-public-go/lib/crpc/crpctest"
+)
+
+type whoamiResponse struct {
+	Service string `json:"service"`
+}
+
+func newServer(t *testing.T) *crpctest.Server {
+	t.Helper()
+
+	rpc := crpc.NewServer(authenforce.CRPCMiddleware(authenforce.Enforcers{authenforce.UnsafeAllowAny}))
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Use(crpc.Logger())
+	rpc.Register("whoami", "2019-01-01", nil, func(ctx context.Context) (*whoamiResponse, error) {
+		a := actor.GetActor(ctx)
+		if a == nil {
+			return nil, cher.New("no_actor", nil)
+		}
+
+		service, _ := a.Params["service"].(string)
+
+		return &whoamiResponse{Service: service}, nil
+	})
+
+	return crpctest.NewServer(t, rpc)
+}
+
+func TestServer(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	srv := newServer(t)
+
+	ctx = crpctest.WithAuthState(ctx, struct{}{})
+	ctx = crpctest.WithActor(ctx, actor.NewService("test", "crpctest"))
+	ctx, res := crpctest.CaptureResponse(ctx)
+
+	var out whoamiResponse
+	err := srv.Client.Do(ctx, "whoami", "2019-01-01", nil, &out)
+	is.NoErr(err)
+	is.Equal(out.Service, "crpctest")
+
+	crpctest.AssertEndpointStatus(t, res, crpc.StableNotice)
+}
+
+func TestServerUnauthenticated(t *testing.T) {
+	srv := newServer(t)
+
+	err := srv.Client.Do(t.Context(), "whoami", "latest", nil, nil)
+
+	crpctest.AssertCode(t, err, cher.Unauthorized)
+	crpctest.AssertReason(t, err, "auth_not_provided")
+}
+
+func TestAssertCompatible(t *testing.T) {
+	is := is.New(t)
+
+	rpc := crpc.NewServer(authenforce.CRPCMiddleware(authenforce.Enforcers{authenforce.UnsafeAllowAny}))
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("whoami", "2019-01-01", nil, func(context.Context) (*whoamiResponse, error) {
+		return &whoamiResponse{}, nil
+	})
+
+	filename := filepath.Join(t.TempDir(), "snapshot.json")
+
+	crpctest.AssertCompatible(t, rpc, filename)
+
+	_, err := os.Stat(filename)
+	is.NoErr(err) // the snapshot is written when missing
+
+	crpctest.AssertCompatible(t, rpc, filename)
+}
@@ -0,0 +1,124 @@
+package crpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/clog"
+)
+
+// DeprecatedNotice is the contents of the `Infra-Endpoint-Status` header when
+// an endpoint is called with a version which has been deprecated.
+const DeprecatedNotice = `deprecated`
+
+// Deprecation schedules the retirement of a version or method. From
+// DeprecatedAt responses carry an RFC 9745 `Deprecation` header and the request
+// log is marked with `rpc_deprecated`. SunsetAt is optional: when set,
+// responses also carry an RFC 8594 `Sunset` header, and from then requests fail
+// with cher.EndpointWithdrawn.
+type Deprecation struct {
+	DeprecatedAt time.Time `json:"deprecated_at"`
+	SunsetAt     time.Time `json:"sunset_at,omitzero"`
+
+	// Link optionally points to documentation on migrating away
+	Link string `json:"link,omitempty"`
+}
+
+// Deprecate schedules the retirement of a dated version, or only the given
+// methods when requested with that version. Method deprecations take priority
+// over the deprecation of their version. The version and methods must already
+// be registered. This function is not thread safe and must be run in serial,
+// along with Register.
+func (s *Server) Deprecate(version string, d Deprecation, methods ...string) {
+	if !expVersion.MatchString(version) || version == VersionPreview {
+		panic(fmt.Sprintf("cannot deprecate version '%s', only dated versions can be deprecated", version))
+	} else if d.DeprecatedAt.IsZero() || (!d.SunsetAt.IsZero() && d.SunsetAt.Before(d.DeprecatedAt)) {
+		panic("deprecation must have a deprecation date, before its sunset date if it has one")
+	}
+
+	resolved, ok := s.resolvedMethods[version]
+	if !ok {
+		panic(fmt.Sprintf("cannot deprecate version '%s', it isn't registered", version))
+	}
+
+	for _, method := range methods {
+		if resolved[method] == nil {
+			panic(fmt.Sprintf("cannot deprecate '%s' on version '%s', it isn't registered", method, version))
+		}
+	}
+
+	if s.deprecations == nil {
+		s.deprecations = make(map[string]map[string]Deprecation)
+	}
+
+	if s.deprecations[version] == nil {
+		s.deprecations[version] = make(map[string]Deprecation)
+	}
+
+	if len(methods) == 0 {
+		methods = []string{""}
+	}
+
+	for _, method := range methods {
+		if _, ok := s.deprecations[version][method]; ok {
+			panic(fmt.Sprintf("deprecation of '%s' on version '%s' is already defined", method, version))
+		}
+
+		s.deprecations[version][method] = d
+	}
+}
+
+// deprecation returns the deprecation applying to a method requested with a
+// version, if any
+func (s *Server) deprecation(version, method string) (Deprecation, bool) {
+	methodSet, ok := s.deprecations[version]
+	if !ok {
+		return Deprecation{}, false
+	}
+
+	if d, ok := methodSet[method]; ok {
+		return d, true
+	}
+
+	d, ok := methodSet[""]
+	return d, ok
+}
+
+// applyDeprecation sets the deprecation headers of a response, returning
+// cher.EndpointWithdrawn once the sunset date has passed
+func applyDeprecation(ctx context.Context, w http.ResponseWriter, req *Request, d Deprecation) error {
+	now := time.Now()
+
+	if !d.SunsetAt.IsZero() && !now.Before(d.SunsetAt) {
+		return cher.New(cher.EndpointWithdrawn, cher.M{
+			"version":   req.Version,
+			"sunset_at": d.SunsetAt,
+		})
+	}
+
+	w.Header().Set("Deprecation", "@"+strconv.FormatInt(d.DeprecatedAt.Unix(), 10))
+
+	if !d.SunsetAt.IsZero() {
+		w.Header().Set("Sunset", d.SunsetAt.UTC().Format(http.TimeFormat))
+	}
+
+	if d.Link != "" {
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"`, d.Link))
+	}
+
+	if now.Before(d.DeprecatedAt) {
+		return nil
+	}
+
+	w.Header().Set(InfraEndpointStatus, DeprecatedNotice)
+
+	// the request log identifies the caller, so marking it is enough to find
+	// who still uses the endpoint
+	clog.SetField(ctx, "rpc_deprecated", true)
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package crpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/sirupsen/logrus"
+	"github.com/wearemojo/mojo-public-go/lib/clog"
+)
+
+func TestDeprecation(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("ping", "2019-01-01", nil, func(context.Context) error { return nil })
+	rpc.Register("pong", "2019-01-01", nil, func(context.Context) error { return nil })
+	rpc.Register("ping", "2020-01-01", nil, func(context.Context) error { return nil })
+	rpc.Register("pang", "2020-01-01", nil, func(context.Context) error { return nil })
+
+	rpc.Deprecate("2019-01-01", Deprecation{
+		DeprecatedAt: now.Add(-time.Hour),
+		SunsetAt:     now.Add(time.Hour),
+		Link:         "https://example.com/migrating",
+	})
+	rpc.Deprecate("2019-01-01", Deprecation{
+		DeprecatedAt: now.Add(-2 * time.Hour),
+		SunsetAt:     now.Add(-time.Hour),
+	}, "pong")
+	rpc.Deprecate("2020-01-01", Deprecation{
+		DeprecatedAt: now.Add(-time.Hour),
+	}, "pang")
+
+	do := func(t *testing.T, path string) (*httptest.ResponseRecorder, logrus.Fields) {
+		t.Helper()
+
+		ctx := clog.Set(t.Context(), logrus.NewEntry(logrus.New()))
+
+		rec := httptest.NewRecorder()
+		r, _ := http.NewRequestWithContext(ctx, http.MethodPost, path, nil)
+
+		rpc.ServeHTTP(rec, r)
+
+		return rec, clog.Get(ctx).Data
+	}
+
+	t.Run("Deprecated", func(t *testing.T) {
+		is := is.New(t)
+
+		rec, fields := do(t, "/2019-01-01/ping")
+
+		is.Equal(rec.Code, http.StatusNoContent)
+		is.Equal(rec.Header().Get("Deprecation"), "@"+strconv.FormatInt(now.Add(-time.Hour).Unix(), 10))
+		is.Equal(rec.Header().Get("Sunset"), now.Add(time.Hour).UTC().Format(http.TimeFormat))
+		is.Equal(rec.Header().Get("Link"), `<https://example.com/migrating>; rel="deprecation"`)
+		is.Equal(rec.Header().Get(InfraEndpointStatus), DeprecatedNotice)
+		is.Equal(fields["rpc_deprecated"], true)
+	})
+
+	t.Run("WithoutSunset", func(t *testing.T) {
+		is := is.New(t)
+
+		rec, fields := do(t, "/2020-01-01/pang")
+
+		is.Equal(rec.Code, http.StatusNoContent)
+		is.Equal(rec.Header().Get("Deprecation"), "@"+strconv.FormatInt(now.Add(-time.Hour).Unix(), 10))
+		is.Equal(rec.Header().Get("Sunset"), "")
+		is.Equal(fields["rpc_deprecated"], true)
+	})
+
+	t.Run("Sunset", func(t *testing.T) {
+		is := is.New(t)
+
+		rec, _ := do(t, "/2019-01-01/pong")
+
+		is.Equal(rec.Code, http.StatusGone)
+		is.True(strings.Contains(rec.Body.String(), `"code":"endpoint_withdrawn"`))
+	})
+
+	t.Run("LaterVersion", func(t *testing.T) {
+		is := is.New(t)
+
+		rec, fields := do(t, "/2020-01-01/pong")
+
+		is.Equal(rec.Code, http.StatusNoContent)
+		is.Equal(rec.Header().Get("Deprecation"), "")
+		is.Equal(fields["rpc_deprecated"], nil)
+		is.Equal(rec.Header().Get(InfraEndpointStatus), StableNotice)
+	})
+
+	t.Run("Introspection", func(t *testing.T) {
+		is := is.New(t)
+
+		methods := rpc.Introspect().Versions[0].Methods
+		is.Equal(methods[0].Method, "ping")
+		is.Equal(methods[0].Deprecation.SunsetAt, now.Add(time.Hour))
+
+		for _, version := range rpc.Introspect().Versions {
+			if version.Version != "2020-01-01" {
+				continue
+			}
+
+			for _, method := range version.Methods {
+				if method.Method != "pang" {
+					continue
+				}
+
+				data, err := json.Marshal(method.Deprecation)
+				is.NoErr(err)
+				is.True(!strings.Contains(string(data), "sunset_at")) // no sunset is omitted
+			}
+		}
+	})
+}
+
+func TestDeprecateInvalid(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		version string
+		d       Deprecation
+		methods []string
+	}{
+		{"Preview", VersionPreview, Deprecation{DeprecatedAt: now}, nil},
+		{"NoDeprecationDate", "2019-01-01", Deprecation{SunsetAt: now}, nil},
+		{"SunsetBeforeDeprecation", "2019-01-01", Deprecation{DeprecatedAt: now, SunsetAt: now.Add(-time.Hour)}, nil},
+		{"UnregisteredVersion", "2018-01-01", Deprecation{DeprecatedAt: now}, nil},
+		{"UnregisteredMethod", "2019-01-01", Deprecation{DeprecatedAt: now}, []string{"pong"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+
+			rpc := NewServer(UnsafeNoAuthentication)
+			rpc.AllowMissingAuthPolicies = true
+			rpc.Register("ping", "2019-01-01", nil, func(context.Context) error { return nil })
+
+			defer func() {
+				is.True(recover() != nil)
+			}()
+
+			rpc.Deprecate(test.version, test.d, test.methods...)
+		})
+	}
+}
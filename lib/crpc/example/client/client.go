@@ -5,30 +5,15 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/wearemojo/mojo-public-go/lib/crpc"
 	"github.com/wearemojo/mojo-public-go/lib/crpc/example"
 	"github.com/wearemojo/mojo-public-go/lib/merr"
 	"github.com/wearemojo/mojo-public-go/lib/mlog"
 )
 
-type ExampleClient struct {
-	*crpc.Client
-}
-
-func (ec *ExampleClient) Ping(ctx context.Context) error {
-	return ec.Do(ctx, "ping", "2017-11-08", nil, nil)
-}
-
-func (ec *ExampleClient) Greet(ctx context.Context, req *example.GreetRequest) (res *example.GreetResponse, err error) {
-	return res, ec.Do(ctx, "greet", "2017-11-08", req, &res)
-}
-
 func main() {
-	var client example.Service = &ExampleClient{
-		Client: crpc.NewClient(context.Background(), "http://127.0.0.1:3000/v1", &http.Client{
-			Timeout: 5 * time.Second,
-		}),
-	}
+	var client example.Service = NewExampleClient(context.Background(), "http://127.0.0.1:3000/v1", &http.Client{
+		Timeout: 5 * time.Second,
+	})
 
 	ctx := context.Background()
 
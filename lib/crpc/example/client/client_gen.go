@@ -0,0 +1,39 @@
+// Code generated by crpcgen. DO NOT EDIT.
+
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/wearemojo/mojo-public-go/lib/crpc"
+	"github.com/wearemojo/mojo-public-go/lib/crpc/example"
+)
+
+var _ example.Service = (*ExampleClient)(nil)
+
+var greetSchema = crpc.MustCompileSchema(example.GreetRequestSchema)
+
+// ExampleClient is a typed crpc client for Service.
+type ExampleClient struct {
+	*crpc.Client
+}
+
+// NewExampleClient returns a client for the service at baseURL.
+func NewExampleClient(ctx context.Context, baseURL string, c *http.Client) *ExampleClient {
+	return &ExampleClient{crpc.NewClient(ctx, baseURL, c)}
+}
+
+// Ping calls ping, pinned to version 2017-11-08.
+func (c *ExampleClient) Ping(ctx context.Context) error {
+	return c.Do(ctx, "ping", "2017-11-08", nil, nil)
+}
+
+// Greet calls greet, pinned to version 2017-11-08.
+func (c *ExampleClient) Greet(ctx context.Context, req *example.GreetRequest) (res *example.GreetResponse, err error) {
+	if err := crpc.ValidateRequest(greetSchema, req); err != nil {
+		return res, err
+	}
+
+	return res, c.Do(ctx, "greet", "2017-11-08", req, &res)
+}
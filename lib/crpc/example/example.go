@@ -6,6 +6,8 @@ import (
 	"github.com/xeipuuv/gojsonschema"
 )
 
+//go:generate go run github.com/wearemojo/mojo-public-go/lib/crpc/crpcgen -interface Service -registration ./server/server.go -output ./client/client_gen.go -package main -type ExampleClient
+
 type Service interface {
 	Ping(context.Context) error
 	Greet(context.Context, *GreetRequest) (*GreetResponse, error)
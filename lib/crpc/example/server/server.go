@@ -59,8 +59,8 @@ func main() {
 	rpc.Use(crpc.Logger())
 
 	// register Ping and Greet (version 2017-11-08)
-	rpc.Register("ping", "2017-11-08", nil, svc.Ping)
-	rpc.Register("greet", "2017-11-08", example.GreetRequestSchema, svc.Greet)
+	rpc.RegisterWithOptions("ping", "2017-11-08", nil, svc.Ping, crpc.Public())
+	rpc.RegisterWithOptions("greet", "2017-11-08", example.GreetRequestSchema, svc.Greet, crpc.Public())
 
 	mux := chi.NewRouter()
 	mux.Use(request.Logger(log))
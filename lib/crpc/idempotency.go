@@ -0,0 +1,303 @@
+package crpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/wearemojo/mojo-public-go/lib/actor"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/merr"
+	"github.com/wearemojo/mojo-public-go/lib/mlog"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header carrying the idempotency key
+	// chosen by the caller. Keys should be unique per operation, e.g. a KSUID.
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotentReplayedHeader is set on responses replayed from an
+	// IdempotencyStore rather than produced by the method.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotencyRecord is the state of an idempotency key in an IdempotencyStore.
+// Response is nil while the first request with the key is still running.
+type IdempotencyRecord struct {
+	RequestHash []byte               `bson:"request_hash"`
+	Response    *IdempotencyResponse `bson:"response"`
+}
+
+// IdempotencyResponse is the stored response of the first request made with
+// an idempotency key. Error is set instead of Status and Body when the method
+// returned a cher error.
+type IdempotencyResponse struct {
+	Status int         `bson:"status"`
+	Header http.Header `bson:"header"`
+	Body   []byte      `bson:"body"`
+	Error  *cher.E     `bson:"error"`
+}
+
+// IdempotencyStore stores the responses of requests made with an idempotency
+// key. Implementations must be safe for concurrent use.
+type IdempotencyStore interface {
+	// Claim records that a request with the key has started, unless the key is
+	// already known, in which case its existing record is returned instead.
+	// Claims expire at expiresAt, after which the key may be claimed again.
+	Claim(ctx context.Context, key string, requestHash []byte, expiresAt time.Time) (*IdempotencyRecord, error)
+
+	// Complete stores the response of the request which claimed the key.
+	Complete(ctx context.Context, key string, res *IdempotencyResponse) error
+
+	// Release removes the claim of a request which failed unexpectedly, so it
+	// can be retried with the same key.
+	Release(ctx context.Context, key string) error
+}
+
+// Idempotency stores the response of the first request made with an
+// Idempotency-Key header and replays it for repeats of the request within the
+// ttl, without calling the method again. Successful responses and cher errors
+// below 500 are stored, while other errors allow the request to be retried.
+//
+// A repeat with a different body fails with cher.IdempotencyKeyReused, and a
+// repeat made while the first request is still running fails with
+// cher.IdempotencyKeyInUse. Streamed methods can't be called with a key, as
+// their responses can't be stored.
+func Idempotency(store IdempotencyStore, ttl time.Duration) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(res http.ResponseWriter, req *Request) error {
+			key := req.originalRequest.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				return next(res, req)
+			}
+
+			ctx := req.Context()
+
+			// streamed responses can't be stored and replayed
+			if req.streaming {
+				return cher.New(cher.BadRequest, cher.M{"header": IdempotencyKeyHeader}, cher.New("idempotency_stream_unsupported", nil))
+			}
+
+			if len(key) > maxIdempotencyKeyLength {
+				return cher.New(cher.BadRequest, cher.M{"header": IdempotencyKeyHeader}, cher.New("idempotency_key_too_long", cher.M{
+					"max_length": maxIdempotencyKeyLength,
+				}))
+			}
+
+			var body []byte
+			if req.Body != nil {
+				var err error
+				body, err = io.ReadAll(req.Body)
+				if err != nil {
+					return merr.New(ctx, "request_body_read_failed", nil, err)
+				}
+
+				req.Body = io.NopCloser(bytes.NewReader(body))
+			}
+
+			storeKey, err := idempotencyStoreKey(ctx, req, key)
+			if err != nil {
+				return err
+			}
+
+			requestHash := sha256.Sum256(body)
+
+			record, err := store.Claim(ctx, storeKey, requestHash[:], time.Now().Add(ttl))
+			if err != nil {
+				return merr.New(ctx, "idempotency_claim_failed", nil, err)
+			}
+
+			if record != nil {
+				switch {
+				case !bytes.Equal(record.RequestHash, requestHash[:]):
+					return cher.New(cher.IdempotencyKeyReused, nil)
+				case record.Response == nil:
+					return cher.New(cher.IdempotencyKeyInUse, nil)
+				}
+
+				return replayIdempotentResponse(res, record.Response)
+			}
+
+			// the outcome must be stored even if the caller has gone away, as the
+			// method has already run
+			storeCtx := context.WithoutCancel(ctx)
+
+			// the claim is released unless a response is stored, so a panicking
+			// method doesn't leave the key in use until it expires
+			settled := false
+			defer func() {
+				if settled {
+					return
+				}
+
+				if rerr := store.Release(storeCtx, storeKey); rerr != nil {
+					mlog.Warn(ctx, merr.New(ctx, "idempotency_release_failed", nil, rerr))
+				}
+			}()
+
+			w := &idempotencyResponseWriter{ResponseWriter: res}
+			err = next(w, req)
+
+			stored := &IdempotencyResponse{
+				Status: w.status,
+				Header: maps.Clone(res.Header()),
+				Body:   w.body.Bytes(),
+			}
+
+			if stored.Status == 0 {
+				stored.Status = http.StatusOK
+			}
+
+			if err != nil {
+				cerr, ok := errors.AsType[cher.E](err)
+				if !ok || cerr.StatusCode() >= http.StatusInternalServerError {
+					return err
+				}
+
+				stored = &IdempotencyResponse{Error: &cerr}
+			}
+
+			settled = true
+
+			if cerr := store.Complete(storeCtx, storeKey, stored); cerr != nil {
+				mlog.Warn(ctx, merr.New(ctx, "idempotency_complete_failed", nil, cerr))
+			}
+
+			return err
+		}
+	}
+}
+
+// idempotencyStoreKey scopes an idempotency key to the caller, version and
+// method, so callers can't see each other's responses by reusing a key.
+// Unauthenticated callers share a scope.
+func idempotencyStoreKey(ctx context.Context, req *Request, key string) (string, error) {
+	var principal []byte
+	if a := actor.GetActor(ctx); a != nil {
+		var err error
+		if principal, err = json.Marshal(a); err != nil {
+			return "", merr.New(ctx, "idempotency_principal_marshal_failed", nil, err)
+		}
+	}
+
+	hash := sha256.New()
+	for _, part := range [][]byte{principal, []byte(req.ResolvedVersion), []byte(req.Method), []byte(key)} {
+		hash.Write(part)
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func replayIdempotentResponse(w http.ResponseWriter, res *IdempotencyResponse) error {
+	w.Header().Set(IdempotentReplayedHeader, "true")
+
+	if res.Error != nil {
+		return *res.Error
+	}
+
+	maps.Copy(w.Header(), res.Header)
+	w.WriteHeader(res.Status)
+
+	_, err := w.Write(res.Body)
+	return err
+}
+
+// idempotencyResponseWriter records the response written by a method, while
+// still writing it to the client as normal
+type idempotencyResponseWriter struct {
+	http.ResponseWriter
+
+	status int
+	body   bytes.Buffer
+}
+
+func (w *idempotencyResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *idempotencyResponseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore which keeps records in memory,
+// so is only suitable for tests and services running a single instance.
+type MemoryIdempotencyStore struct {
+	lock    sync.Mutex
+	records map[string]memoryIdempotencyRecord
+}
+
+type memoryIdempotencyRecord struct {
+	IdempotencyRecord
+
+	expiresAt time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		records: map[string]memoryIdempotencyRecord{},
+	}
+}
+
+func (s *MemoryIdempotencyStore) Claim(_ context.Context, key string, requestHash []byte, expiresAt time.Time) (*IdempotencyRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+
+	maps.DeleteFunc(s.records, func(_ string, record memoryIdempotencyRecord) bool {
+		return !record.expiresAt.After(now)
+	})
+
+	if record, ok := s.records[key]; ok {
+		return &record.IdempotencyRecord, nil
+	}
+
+	s.records[key] = memoryIdempotencyRecord{
+		IdempotencyRecord: IdempotencyRecord{RequestHash: requestHash},
+		expiresAt:         expiresAt,
+	}
+
+	return nil, nil //nolint:nilnil // a nil record means the key was claimed
+}
+
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, res *IdempotencyResponse) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if record, ok := s.records[key]; ok {
+		record.Response = res
+		s.records[key] = record
+	}
+
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.records, key)
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package crpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/sirupsen/logrus"
+	"github.com/wearemojo/mojo-public-go/lib/actor"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/clog"
+)
+
+type idempotencyTestRequest struct {
+	Amount int `json:"amount"`
+}
+
+type idempotencyTestResponse struct {
+	Charge int `json:"charge"`
+}
+
+func TestIdempotency(t *testing.T) {
+	var charges int
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.RegisterFunc("charge", "2019-01-01", nil, &MustWrap(func(_ context.Context, req *idempotencyTestRequest) (*idempotencyTestResponse, error) {
+		charges++
+
+		switch req.Amount {
+		case 0:
+			return nil, cher.New("amount_invalid", nil)
+		case 1:
+			return nil, errors.New("payment provider unavailable")
+		}
+
+		return &idempotencyTestResponse{Charge: charges}, nil
+	}).Handler, Idempotency(NewMemoryIdempotencyStore(), time.Hour))
+
+	do := func(t *testing.T, key, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		r, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, "/2019-01-01/charge", strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(IdempotencyKeyHeader, key)
+		}
+
+		rpc.ServeHTTP(rec, r)
+
+		return rec
+	}
+
+	t.Run("Replayed", func(t *testing.T) {
+		is := is.New(t)
+		charges = 0
+
+		first := do(t, "key_replayed", `{"amount":10}`)
+		is.Equal(first.Code, http.StatusOK)
+		is.Equal(strings.TrimSpace(first.Body.String()), `{"charge":1}`)
+
+		repeat := do(t, "key_replayed", `{"amount":10}`)
+		is.Equal(repeat.Code, http.StatusOK)
+		is.Equal(repeat.Body.String(), first.Body.String())
+		is.Equal(repeat.Header().Get(IdempotentReplayedHeader), "true")
+		is.Equal(charges, 1)
+
+		other := do(t, "", `{"amount":10}`)
+		is.Equal(strings.TrimSpace(other.Body.String()), `{"charge":2}`)
+	})
+
+	t.Run("Reused", func(t *testing.T) {
+		is := is.New(t)
+
+		do(t, "key_reused", `{"amount":10}`)
+
+		rec := do(t, "key_reused", `{"amount":20}`)
+		is.Equal(rec.Code, http.StatusUnprocessableEntity)
+		is.Equal(strings.TrimSpace(rec.Body.String()), `{"code":"idempotency_key_reused"}`)
+	})
+
+	t.Run("ErrorReplayed", func(t *testing.T) {
+		is := is.New(t)
+		charges = 0
+
+		do(t, "key_error", `{"amount":0}`)
+
+		rec := do(t, "key_error", `{"amount":0}`)
+		is.Equal(rec.Code, http.StatusBadRequest)
+		is.Equal(strings.TrimSpace(rec.Body.String()), `{"code":"amount_invalid"}`)
+		is.Equal(rec.Header().Get(IdempotentReplayedHeader), "true")
+		is.Equal(charges, 1)
+	})
+
+	t.Run("UnexpectedErrorReleased", func(t *testing.T) {
+		is := is.New(t)
+		charges = 0
+
+		do(t, "key_unexpected", `{"amount":1}`)
+
+		rec := do(t, "key_unexpected", `{"amount":1}`)
+		is.Equal(rec.Code, http.StatusInternalServerError)
+		is.Equal(rec.Header().Get(IdempotentReplayedHeader), "")
+		is.Equal(charges, 2)
+	})
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	store := NewMemoryIdempotencyStore()
+
+	record, err := store.Claim(ctx, "key", []byte("hash"), time.Now().Add(time.Hour))
+	is.NoErr(err)
+	is.Equal(record, nil)
+
+	record, err = store.Claim(ctx, "key", []byte("hash"), time.Now().Add(time.Hour))
+	is.NoErr(err)
+	is.Equal(record.Response, nil) // still in progress
+
+	is.NoErr(store.Complete(ctx, "key", &IdempotencyResponse{Status: http.StatusOK}))
+
+	record, err = store.Claim(ctx, "key", []byte("hash"), time.Now().Add(time.Hour))
+	is.NoErr(err)
+	is.Equal(record.Response.Status, http.StatusOK)
+
+	record, err = store.Claim(ctx, "expired", []byte("hash"), time.Now().Add(-time.Second))
+	is.NoErr(err)
+	is.Equal(record, nil)
+
+	record, err = store.Claim(ctx, "expired", []byte("hash"), time.Now().Add(time.Hour))
+	is.NoErr(err)
+	is.Equal(record, nil) // the expired claim was removed
+}
+
+func TestIdempotencyIsScopedToActor(t *testing.T) {
+	is := is.New(t)
+
+	var charges int
+
+	// authenticates callers as the user named by a header
+	authenticate := func(next HandlerFunc) HandlerFunc {
+		return func(res http.ResponseWriter, req *Request) error {
+			ctx := actor.SetActor(req.Context(), actor.Actor{
+				Type:   actor.TypeUser,
+				Params: map[string]any{"user_id": req.originalRequest.Header.Get("Test-User")},
+			})
+			req.originalRequest = req.originalRequest.WithContext(ctx)
+
+			return next(res, req)
+		}
+	}
+
+	rpc := NewServer(authenticate)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("charge", "2019-01-01", nil, func(context.Context) (*idempotencyTestResponse, error) {
+		charges++
+		return &idempotencyTestResponse{Charge: charges}, nil
+	}, Idempotency(NewMemoryIdempotencyStore(), time.Hour))
+
+	do := func(user string) string {
+		rec := httptest.NewRecorder()
+		r, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, "/2019-01-01/charge", nil)
+		r.Header.Set(IdempotencyKeyHeader, "shared_key")
+		r.Header.Set("Test-User", user)
+
+		rpc.ServeHTTP(rec, r)
+		is.Equal(rec.Code, http.StatusOK)
+
+		return strings.TrimSpace(rec.Body.String())
+	}
+
+	is.Equal(do("alice"), `{"charge":1}`)
+	is.Equal(do("bob"), `{"charge":2}`)   // bob doesn't see alice's response
+	is.Equal(do("alice"), `{"charge":1}`) // alice's response is still replayed
+	is.Equal(charges, 2)
+}
+
+func TestIdempotencyReleasedOnPanic(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Use(Recover())
+	rpc.Register("explode_once", "2019-01-01", nil, func(context.Context) error {
+		calls++
+		if calls == 1 {
+			panic("something went wrong")
+		}
+
+		return nil
+	}, Idempotency(NewMemoryIdempotencyStore(), time.Hour))
+
+	ctx := clog.Set(t.Context(), logrus.NewEntry(logrus.New()))
+
+	do := func() int {
+		rec := httptest.NewRecorder()
+		r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/2019-01-01/explode_once", nil)
+		r.Header.Set(IdempotencyKeyHeader, "key_panic")
+
+		rpc.ServeHTTP(rec, r)
+
+		return rec.Code
+	}
+
+	is.Equal(do(), http.StatusInternalServerError)
+	is.Equal(do(), http.StatusNoContent) // the key was released, so the method runs again
+	is.Equal(calls, 2)
+}
+
+func TestIdempotencyInBatch(t *testing.T) {
+	is := is.New(t)
+
+	var charges int
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.EnableBatch(10, 1)
+	rpc.Register("charge", "2019-01-01", nil, func(context.Context) (*idempotencyTestResponse, error) {
+		charges++
+		return &idempotencyTestResponse{Charge: charges}, nil
+	}, Idempotency(NewMemoryIdempotencyStore(), time.Hour))
+
+	do := func() string {
+		rec := httptest.NewRecorder()
+		r, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, "/2019-01-01/_batch", strings.NewReader(`{"calls":[{"method":"charge"},{"method":"charge"}]}`))
+		r.Header.Set(IdempotencyKeyHeader, "key_batch")
+
+		rpc.ServeHTTP(rec, r)
+		is.Equal(rec.Code, http.StatusOK)
+
+		return strings.TrimSpace(rec.Body.String())
+	}
+
+	first := do()
+	is.Equal(first, `{"results":[{"status":200,"header":{"Infra-Endpoint-Status":["stable"]},"body":{"charge":1},"error":null},{"status":200,"header":{"Infra-Endpoint-Status":["stable"]},"body":{"charge":2},"error":null}]}`) // calls don't collide
+
+	// the batch can be retried, with each call replayed
+	is.Equal(do(), `{"results":[{"status":200,"header":{"Idempotent-Replayed":["true"],"Infra-Endpoint-Status":["stable"]},"body":{"charge":1},"error":null},{"status":200,"header":{"Idempotent-Replayed":["true"],"Infra-Endpoint-Status":["stable"]},"body":{"charge":2},"error":null}]}`)
+	is.Equal(charges, 2)
+}
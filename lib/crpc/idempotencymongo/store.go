@@ -0,0 +1,93 @@
+// Package idempotencymongo implements a crpc.IdempotencyStore backed by a
+// MongoDB collection, so idempotency keys are shared across instances.
+package idempotencymongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/wearemojo/mojo-public-go/lib/crpc"
+	"github.com/wearemojo/mojo-public-go/lib/db/mongodb"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var _ crpc.IdempotencyStore = (*Store)(nil)
+
+type Store struct {
+	coll *mongodb.Collection
+}
+
+type record struct {
+	Key string `bson:"_id"`
+
+	crpc.IdempotencyRecord `bson:",inline"`
+
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+func NewStore(coll *mongodb.Collection) *Store {
+	return &Store{coll}
+}
+
+// SetupIndexes creates the TTL index which removes expired records.
+func (s *Store) SetupIndexes() error {
+	return s.coll.SetupIndexes([]mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+}
+
+func (s *Store) Claim(ctx context.Context, key string, requestHash []byte, expiresAt time.Time) (*crpc.IdempotencyRecord, error) {
+	// MongoDB only removes expired records periodically, so they're removed
+	// here before claiming the key
+	if _, err := s.coll.DeleteOne(ctx, bson.M{
+		"_id":        key,
+		"expires_at": bson.M{"$lte": time.Now()},
+	}); err != nil {
+		return nil, err
+	}
+
+	_, err := s.coll.InsertOne(ctx, record{
+		Key: key,
+
+		IdempotencyRecord: crpc.IdempotencyRecord{RequestHash: requestHash},
+
+		ExpiresAt: expiresAt,
+	})
+	if err == nil {
+		return nil, nil //nolint:nilnil // a nil record means the key was claimed
+	} else if !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+
+	var existing record
+	err = s.coll.FindOne(ctx, bson.M{"_id": key}).Decode(&existing)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// the key was released in the meantime, so it's treated as in use and
+		// the caller can retry
+		return &crpc.IdempotencyRecord{RequestHash: requestHash}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &existing.IdempotencyRecord, nil
+}
+
+func (s *Store) Complete(ctx context.Context, key string, res *crpc.IdempotencyResponse) error {
+	_, err := s.coll.UpdateOne(ctx, bson.M{"_id": key}, bson.M{
+		"$set": bson.M{"response": res},
+	})
+
+	return err
+}
+
+func (s *Store) Release(ctx context.Context, key string) error {
+	_, err := s.coll.DeleteOne(ctx, bson.M{"_id": key})
+
+	return err
+}
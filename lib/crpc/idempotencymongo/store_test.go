@@ -0,0 +1,109 @@
+package idempotencymongo
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/crpc"
+	"github.com/wearemojo/mojo-public-go/lib/db/mongodb"
+	"github.com/wearemojo/mojo-public-go/lib/ksuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func TestRecordBSON(t *testing.T) {
+	is := is.New(t)
+
+	in := record{
+		Key: "key",
+
+		IdempotencyRecord: crpc.IdempotencyRecord{
+			RequestHash: []byte("hash"),
+			Response: &crpc.IdempotencyResponse{
+				Status: http.StatusCreated,
+				Header: http.Header{"Content-Type": {"application/json"}},
+				Body:   []byte(`{"ok":true}`),
+				Error:  &cher.E{Code: "foo", Meta: cher.M{"bar": "baz"}},
+			},
+		},
+
+		ExpiresAt: time.Now().Truncate(time.Millisecond).UTC(),
+	}
+
+	data, err := bson.Marshal(in)
+	is.NoErr(err)
+
+	var out record
+	is.NoErr(bson.Unmarshal(data, &out))
+	is.Equal(out, in)
+}
+
+// testStore connects to the MongoDB at MONGODB_URI, skipping the test if it
+// isn't set
+func testStore(t *testing.T) *Store {
+	t.Helper()
+
+	uri := os.Getenv("MONGODB_URI")
+	if uri == "" {
+		t.Skip("MONGODB_URI is not set")
+	}
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = client.Disconnect(t.Context()) })
+
+	coll := client.Database("idempotencymongo_test").Collection("records_" + ksuid.Generate(t.Context(), "test").String())
+	t.Cleanup(func() { _ = coll.Drop(t.Context()) })
+
+	store := NewStore(&mongodb.Collection{Collection: coll})
+	if err := store.SetupIndexes(); err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestStore(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	store := testStore(t)
+
+	rec, err := store.Claim(ctx, "key", []byte("hash"), time.Now().Add(time.Hour))
+	is.NoErr(err)
+	is.Equal(rec, nil)
+
+	rec, err = store.Claim(ctx, "key", []byte("other"), time.Now().Add(time.Hour))
+	is.NoErr(err)
+	is.Equal(rec.RequestHash, []byte("hash"))
+	is.Equal(rec.Response, nil) // still in progress
+
+	is.NoErr(store.Complete(ctx, "key", &crpc.IdempotencyResponse{Status: http.StatusOK, Body: []byte("{}")}))
+
+	rec, err = store.Claim(ctx, "key", []byte("hash"), time.Now().Add(time.Hour))
+	is.NoErr(err)
+	is.Equal(rec.Response.Status, http.StatusOK)
+	is.Equal(rec.Response.Body, []byte("{}"))
+
+	is.NoErr(store.Release(ctx, "key"))
+
+	rec, err = store.Claim(ctx, "key", []byte("hash"), time.Now().Add(time.Hour))
+	is.NoErr(err)
+	is.Equal(rec, nil) // released keys can be claimed again
+
+	rec, err = store.Claim(ctx, "expired", []byte("hash"), time.Now().Add(-time.Second))
+	is.NoErr(err)
+	is.Equal(rec, nil)
+
+	rec, err = store.Claim(ctx, "expired", []byte("hash"), time.Now().Add(time.Hour))
+	is.NoErr(err)
+	is.Equal(rec, nil) // the expired claim was removed
+}
@@ -0,0 +1,148 @@
+package crpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/matryer/is"
+	"github.com/sirupsen/logrus"
+	"github.com/wearemojo/mojo-public-go/lib/actor"
+	"github.com/wearemojo/mojo-public-go/lib/authparsing"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/clog"
+	"github.com/wearemojo/mojo-public-go/lib/jwt"
+	"github.com/wearemojo/mojo-public-go/lib/jwt/golangjwt"
+	"github.com/wearemojo/mojo-public-go/lib/servicecontext"
+)
+
+// hmacJWT signs and verifies tokens with a shared key, standing in for KMS
+type hmacJWT []byte
+
+func (k hmacJWT) Sign(_ context.Context, expiresAt time.Time, customClaims jwt.Claims) (string, error) {
+	claims := gojwt.MapClaims{"exp": expiresAt.Unix()}
+	for key, val := range customClaims {
+		claims[key] = val
+	}
+
+	return gojwt.NewWithClaims(gojwt.SigningMethodHS256, claims).SignedString([]byte(k))
+}
+
+func (k hmacJWT) Verify(ctx context.Context, token string) (jwt.Claims, error) {
+	claims := gojwt.MapClaims{}
+	_, err := gojwt.ParseWithClaims(token, claims, func(*gojwt.Token) (any, error) {
+		return []byte(k), nil
+	}, gojwt.WithValidMethods([]string{gojwt.SigningMethodHS256.Alg()}))
+
+	return claims, golangjwt.HandleVerifyError(ctx, err)
+}
+
+// internalAuthTestServer serves rpc as service, with internal tokens accepted
+func internalAuthTestServer(t *testing.T, service string, key hmacJWT, rpc *Server) *httptest.Server {
+	t.Helper()
+
+	parser := authparsing.Parser{
+		Handlers: map[string]authparsing.Handler{
+			"internal": InternalTokenHandler(),
+		},
+	}
+
+	handler := authparsing.Middleware(parser)(rpc)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := clog.Set(r.Context(), logrus.NewEntry(logrus.New()))
+		ctx = servicecontext.SetContext(ctx, servicecontext.Info{Env: "test", Service: service})
+		ctx = jwt.ContextWithSigner(ctx, key)
+		ctx = jwt.ContextWithVerifier(ctx, key)
+
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestInternalAuth(t *testing.T) {
+	is := is.New(t)
+
+	key := hmacJWT("secret")
+
+	var state *InternalAuthState
+	var callActor *actor.Actor
+
+	last := NewServer(UnsafeNoAuthentication)
+	last.AllowMissingAuthPolicies = true
+	last.Register("whoami", "2019-01-01", nil, func(ctx context.Context) error {
+		state, _ = authparsing.GetAuthState(ctx).(*InternalAuthState)
+		callActor = actor.GetActor(ctx)
+		return nil
+	})
+
+	lastSrv := internalAuthTestServer(t, "last", key, last)
+
+	middle := NewServer(UnsafeNoAuthentication)
+	middle.AllowMissingAuthPolicies = true
+	middle.Register("forward", "2019-01-01", nil, func(ctx context.Context) error {
+		client := NewClient(ctx, lastSrv.URL, nil)
+		client.UseInternalAuth()
+
+		return client.Do(ctx, "whoami", "2019-01-01", nil, nil)
+	})
+
+	middleSrv := internalAuthTestServer(t, "middle", key, middle)
+
+	user := actor.NewExternalUser("test", "1", "ref")
+
+	ctx := servicecontext.SetContext(t.Context(), servicecontext.Info{Env: "test", Service: "first"})
+	ctx = jwt.ContextWithSigner(ctx, key)
+	ctx = actor.SetActor(ctx, user)
+
+	client := NewClient(ctx, middleSrv.URL, nil)
+	client.UseInternalAuth()
+
+	is.NoErr(client.Do(ctx, "forward", "2019-01-01", nil, nil))
+
+	is.True(state != nil)
+	is.Equal(state.Service, actor.NewService("test", "middle"))
+	is.Equal(state.Chain, []actor.Actor{
+		actor.NewService("test", "first"),
+		actor.NewService("test", "middle"),
+	})
+
+	// the actor survives both hops
+	is.Equal(callActor.Type, user.Type)
+	is.Equal(callActor.Params["reference"], "ref")
+}
+
+func TestInternalAuthRejected(t *testing.T) {
+	is := is.New(t)
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("whoami", "2019-01-01", nil, func(context.Context) error {
+		return nil
+	})
+
+	srv := internalAuthTestServer(t, "last", hmacJWT("secret"), rpc)
+
+	ctx := servicecontext.SetContext(t.Context(), servicecontext.Info{Env: "test", Service: "first"})
+	ctx = jwt.ContextWithSigner(ctx, hmacJWT("wrong"))
+
+	client := NewClient(ctx, srv.URL, nil)
+	client.UseInternalAuth()
+
+	err := client.Do(ctx, "whoami", "2019-01-01", nil, nil)
+	cerr, ok := err.(cher.E) //nolint:errorlint // required for test
+	is.True(ok)
+	is.Equal(cerr.Code, cher.Unauthorized)
+	is.Equal(cerr.Reasons[0].Code, "token_bad_signature")
+
+	// a service context is needed to identify the caller
+	ctx = jwt.ContextWithSigner(t.Context(), hmacJWT("secret"))
+
+	err = client.Do(ctx, "whoami", "2019-01-01", nil, nil)
+	is.True(err != nil)
+}
@@ -0,0 +1,161 @@
+package crpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/merr"
+	"github.com/wearemojo/mojo-public-go/lib/mlog"
+)
+
+// Introspection describes how the methods registered on a server resolve
+type Introspection struct {
+	// Versions contains every version methods can be requested with, including
+	// `latest` and `preview` when they exist
+	Versions []IntrospectionVersion `json:"versions"`
+
+	// PreviewOnly lists methods which are only available on the preview version
+	PreviewOnly []string `json:"preview_only"`
+
+	// Withdrawn lists methods which were withdrawn with a nil registration
+	Withdrawn []IntrospectionWithdrawal `json:"withdrawn"`
+}
+
+type IntrospectionVersion struct {
+	Version string                `json:"version"`
+	Methods []IntrospectionMethod `json:"methods"`
+}
+
+type IntrospectionMethod struct {
+	Method          string `json:"method"`
+	ResolvedVersion string `json:"resolved_version"`
+	HasRequestBody  bool   `json:"has_request_body"`
+
+	// AuthPolicy is the name of the method's auth policy, `public` for methods
+	// registered with Public, or empty if it has none
+	AuthPolicy string `json:"auth_policy"`
+
+	Deprecation *Deprecation `json:"deprecation,omitempty"`
+}
+
+type IntrospectionWithdrawal struct {
+	Method  string `json:"method"`
+	Version string `json:"version"`
+}
+
+// Introspect returns which registered version every method resolves to for
+// each version known by the server.
+func (s *Server) Introspect() *Introspection {
+	res := &Introspection{
+		Versions:    []IntrospectionVersion{},
+		PreviewOnly: []string{},
+		Withdrawn:   []IntrospectionWithdrawal{},
+	}
+
+	versions := sort.StringSlice{}
+	for version := range s.resolvedMethods {
+		versions = append(versions, version)
+	}
+	sort.Sort(versions)
+
+	for _, version := range versions {
+		iv := IntrospectionVersion{
+			Version: version,
+			Methods: []IntrospectionMethod{},
+		}
+
+		for method, handler := range s.resolvedMethods[version] {
+			if handler == nil {
+				continue
+			}
+
+			im := IntrospectionMethod{
+				Method:          method,
+				ResolvedVersion: handler.v,
+				HasRequestBody:  handler.schema != nil,
+				AuthPolicy:      handler.opts.authPolicyName(),
+			}
+
+			if d, ok := s.deprecation(version, method); ok {
+				im.Deprecation = &d
+			}
+
+			iv.Methods = append(iv.Methods, im)
+		}
+
+		slices.SortFunc(iv.Methods, func(a, b IntrospectionMethod) int {
+			return strings.Compare(a.Method, b.Method)
+		})
+
+		res.Versions = append(res.Versions, iv)
+	}
+
+	for method := range s.registeredPreviewMethods {
+		if _, ok := s.resolvedMethods[VersionLatest][method]; !ok {
+			res.PreviewOnly = append(res.PreviewOnly, method)
+		}
+	}
+
+	sort.Strings(res.PreviewOnly)
+
+	for version, methodSet := range s.registeredVersionMethods {
+		for method, handler := range methodSet {
+			if handler == nil {
+				res.Withdrawn = append(res.Withdrawn, IntrospectionWithdrawal{
+					Method:  method,
+					Version: version,
+				})
+			}
+		}
+	}
+
+	slices.SortFunc(res.Withdrawn, func(a, b IntrospectionWithdrawal) int {
+		if a.Version != b.Version {
+			return strings.Compare(a.Version, b.Version)
+		}
+
+		return strings.Compare(a.Method, b.Method)
+	})
+
+	return res
+}
+
+// IntrospectionHandler returns an HTTP handler serving the server's
+// introspection. It is guarded by the server's AuthenticationMiddleware, so
+// must only be mounted when that is sufficient to restrict access.
+func (s *Server) IntrospectionHandler() http.Handler {
+	handler := func(w http.ResponseWriter, req *Request) error {
+		ctx := req.Context()
+
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(s.Introspect()); err != nil {
+			mlog.Warn(ctx, merr.New(ctx, "crpc_introspection_write_failed", nil, err))
+		}
+
+		return nil
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		req := newRequest(r)
+		ctx := req.Context()
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+		if s.AuthenticationMiddleware == nil {
+			s.writeError(ctx, w, r, cher.New(cher.AccessDenied, nil))
+			return
+		}
+
+		s.writeError(ctx, w, r, s.AuthenticationMiddleware(handler)(w, req))
+	})
+}
@@ -0,0 +1,82 @@
+package crpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+)
+
+func TestIntrospect(t *testing.T) {
+	is := is.New(t)
+
+	noop := func(context.Context) error { return nil }
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("foo", "2019-01-01", nil, noop)
+	rpc.Register("bar", "2019-01-01", nil, noop)
+	rpc.Register("bar", "2019-02-02", nil, nil)
+	rpc.Register("baz", "preview", nil, noop)
+	rpc.Register("foo", "preview", nil, noop)
+
+	is.Equal(rpc.Introspect(), &Introspection{
+		Versions: []IntrospectionVersion{
+			{
+				Version: "2019-01-01",
+				Methods: []IntrospectionMethod{
+					{Method: "bar", ResolvedVersion: "2019-01-01"},
+					{Method: "foo", ResolvedVersion: "2019-01-01"},
+				},
+			},
+			{
+				Version: "2019-02-02",
+				Methods: []IntrospectionMethod{
+					{Method: "foo", ResolvedVersion: "2019-01-01"},
+				},
+			},
+			{
+				Version: "latest",
+				Methods: []IntrospectionMethod{
+					{Method: "foo", ResolvedVersion: "2019-01-01"},
+				},
+			},
+			{
+				Version: "preview",
+				Methods: []IntrospectionMethod{
+					{Method: "baz", ResolvedVersion: "preview"},
+					{Method: "foo", ResolvedVersion: "preview"},
+				},
+			},
+		},
+		PreviewOnly: []string{"baz"},
+		Withdrawn: []IntrospectionWithdrawal{
+			{Method: "bar", Version: "2019-02-02"},
+		},
+	})
+}
+
+func TestIntrospectionHandlerAuthenticates(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	denyAll := func(HandlerFunc) HandlerFunc {
+		return func(http.ResponseWriter, *Request) error {
+			return cher.New(cher.Unauthorized, nil)
+		}
+	}
+
+	rpc := NewServer(denyAll)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("foo", "2019-01-01", nil, func(context.Context) error { return nil })
+
+	rec := httptest.NewRecorder()
+	r, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/introspection", nil)
+
+	rpc.IntrospectionHandler().ServeHTTP(rec, r)
+
+	is.Equal(rec.Code, http.StatusUnauthorized)
+}
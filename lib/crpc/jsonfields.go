@@ -0,0 +1,137 @@
+package crpc
+
+import (
+	"cmp"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// jsonField is a field of a struct as encoding/json sees it
+type jsonField struct {
+	name string
+	typ  reflect.Type
+	opts string
+
+	index  []int
+	tagged bool
+}
+
+// hasOption reports whether the json tag of the field has the option name
+func (f jsonField) hasOption(name string) bool {
+	return slices.Contains(strings.Split(f.opts, ","), name)
+}
+
+// jsonFields returns the fields encoding/json marshals a struct type with, in
+// the order of their declaration. Fields of embedded structs are promoted, and
+// fields sharing a name are resolved like encoding/json does: the shallowest
+// one wins, then the one with a json tag, and if that leaves more than one
+// they are all ignored.
+func jsonFields(typ reflect.Type) []jsonField {
+	var fields []jsonField
+
+	current := []jsonField{{typ: typ}}
+	visited := map[reflect.Type]bool{}
+
+	for len(current) > 0 {
+		var next []jsonField
+
+		for _, embedded := range current {
+			if visited[embedded.typ] {
+				continue
+			}
+
+			visited[embedded.typ] = true
+
+			for i := range embedded.typ.NumField() {
+				field := embedded.typ.Field(i)
+
+				fieldType := field.Type
+				for fieldType.Kind() == reflect.Pointer {
+					fieldType = fieldType.Elem()
+				}
+
+				if field.Anonymous {
+					if !field.IsExported() && fieldType.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !field.IsExported() {
+					continue
+				}
+
+				tag := field.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+
+				name, opts, _ := strings.Cut(tag, ",")
+				index := append(slices.Clone(embedded.index), i)
+
+				// embedded structs without a name have their fields promoted
+				if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+					next = append(next, jsonField{typ: fieldType, index: index})
+					continue
+				}
+
+				f := jsonField{name: name, typ: field.Type, opts: opts, index: index, tagged: name != ""}
+				if f.name == "" {
+					f.name = field.Name
+				}
+
+				fields = append(fields, f)
+			}
+		}
+
+		current = next
+	}
+
+	byName := map[string][]jsonField{}
+	for _, f := range fields {
+		byName[f.name] = append(byName[f.name], f)
+	}
+
+	dominant := make([]jsonField, 0, len(byName))
+	for _, candidates := range byName {
+		if f, ok := dominantJSONField(candidates); ok {
+			dominant = append(dominant, f)
+		}
+	}
+
+	slices.SortFunc(dominant, func(a, b jsonField) int {
+		return slices.Compare(a.index, b.index)
+	})
+
+	return dominant
+}
+
+// dominantJSONField picks the field encoding/json uses among fields sharing a
+// name, if there is one
+func dominantJSONField(fields []jsonField) (jsonField, bool) {
+	depth := len(slices.MinFunc(fields, func(a, b jsonField) int {
+		return cmp.Compare(len(a.index), len(b.index))
+	}).index)
+
+	var shallowest []jsonField
+	for _, f := range fields {
+		if len(f.index) == depth {
+			shallowest = append(shallowest, f)
+		}
+	}
+
+	if len(shallowest) == 1 {
+		return shallowest[0], true
+	}
+
+	var tagged []jsonField
+	for _, f := range shallowest {
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+
+	if len(tagged) == 1 {
+		return tagged[0], true
+	}
+
+	return jsonField{}, false
+}
@@ -0,0 +1,56 @@
+package crpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+type jsonFieldsTestInner struct {
+	Name   string `json:"name"`
+	Hidden string `json:"hidden"`
+	Shared string `json:"shared"`
+	Header string `json:"Title"`
+}
+
+type jsonFieldsTestOther struct {
+	Shared string `json:"shared"`
+	Title  string
+}
+
+type jsonFieldsTestOuter struct {
+	jsonFieldsTestInner
+	*jsonFieldsTestOther
+
+	Hidden int `json:"hidden"`
+	Own    string
+	Skip   string `json:"-"`
+
+	unexported string
+}
+
+func TestJSONFields(t *testing.T) {
+	is := is.New(t)
+
+	var names []string
+	types := map[string]reflect.Type{}
+	for _, f := range jsonFields(reflect.TypeFor[jsonFieldsTestOuter]()) {
+		names = append(names, f.name)
+		types[f.name] = f.typ
+	}
+
+	// shared is ambiguous so is dropped, while the tagged Title wins
+	is.Equal(names, []string{"name", "Title", "hidden", "Own"})
+	is.Equal(types["hidden"], reflect.TypeFor[int]()) // the shallowest field wins
+
+	data, err := json.Marshal(jsonFieldsTestOuter{
+		jsonFieldsTestInner: jsonFieldsTestInner{Name: "a", Hidden: "b", Shared: "c", Header: "d"},
+		jsonFieldsTestOther: &jsonFieldsTestOther{Shared: "e", Title: "f"},
+		Hidden:              1,
+		Own:                 "g",
+	})
+	is.NoErr(err)
+	is.Equal(string(data), `{"name":"a","Title":"d","hidden":1,"Own":"g"}`) // matches encoding/json
+}
@@ -0,0 +1,160 @@
+package crpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/wearemojo/mojo-public-go/lib/crpc"
+
+// Metrics records OpenTelemetry metrics for every request using the global
+// MeterProvider, and adds the RPC attributes to the active span. Metrics are
+// labelled with the method, the requested and resolved versions, and for
+// failed requests the status class and the cher code, if it is registered in
+// cher.DefaultCatalog, so arbitrary codes can't grow the number of series. The
+// span is given the cher code as it is.
+//
+//   - rpc.server.call.duration (histogram, seconds)
+//   - rpc.server.request.size (histogram, bytes)
+//   - rpc.server.response.size (histogram, bytes, excluding error bodies)
+//   - rpc.server.calls (counter), also labelled with the outcome
+func Metrics() MiddlewareFunc {
+	meter := otel.Meter(instrumentationName)
+
+	duration := mustInstrument(meter.Float64Histogram("rpc.server.call.duration",
+		metric.WithDescription("Duration of RPC calls"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...),
+	))
+
+	requestSize := mustInstrument(meter.Int64Histogram("rpc.server.request.size",
+		metric.WithDescription("Size of RPC request bodies"),
+		metric.WithUnit("By"),
+	))
+
+	responseSize := mustInstrument(meter.Int64Histogram("rpc.server.response.size",
+		metric.WithDescription("Size of RPC response bodies"),
+		metric.WithUnit("By"),
+	))
+
+	calls := mustInstrument(meter.Int64Counter("rpc.server.calls",
+		metric.WithDescription("Number of RPC calls by outcome"),
+		metric.WithUnit("{call}"),
+	))
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(res http.ResponseWriter, req *Request) error {
+			ctx := req.Context()
+
+			attrs := []attribute.KeyValue{
+				attribute.String("rpc.system", "crpc"),
+				attribute.String("rpc.method", req.Method),
+				attribute.String("rpc.version", req.Version),
+				attribute.String("crpc.resolved_version", req.ResolvedVersion),
+			}
+
+			span := trace.SpanFromContext(ctx)
+			span.SetAttributes(attrs...)
+
+			body := &countingReadCloser{ReadCloser: req.Body}
+			if req.Body != nil {
+				req.Body = body
+			}
+
+			w := &countingResponseWriter{ResponseWriter: res}
+
+			tStart := time.Now()
+			err := next(w, req)
+			elapsed := time.Since(tStart)
+
+			outcome := "success"
+			if err != nil {
+				cerr := errorBody(err)
+				attrs = append(attrs, errorAttributes(cerr)...)
+				outcome = "error"
+
+				span.SetAttributes(attribute.String("crpc.cher_code", cerr.Code))
+				if cerr.StatusCode() >= http.StatusInternalServerError {
+					span.SetStatus(codes.Error, cerr.Code)
+				}
+			}
+
+			// the request may have been cancelled, but the metrics must still be
+			// recorded
+			ctx = context.WithoutCancel(ctx)
+			set := metric.WithAttributeSet(attribute.NewSet(attrs...))
+
+			duration.Record(ctx, elapsed.Seconds(), set)
+			requestSize.Record(ctx, body.n, set)
+			responseSize.Record(ctx, w.n, set)
+			calls.Add(ctx, 1, metric.WithAttributeSet(attribute.NewSet(append(attrs, attribute.String("crpc.outcome", outcome))...)))
+
+			return err
+		}
+	}
+}
+
+// durationBuckets are the bucket boundaries in seconds for call durations,
+// as recommended by the OpenTelemetry RPC semantic conventions
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+// errorAttributes labels metrics of a failed request by the class of its
+// status and its code, which is replaced by "other" for codes missing from
+// cher.DefaultCatalog to bound the cardinality of the metrics.
+func errorAttributes(err cher.E) []attribute.KeyValue {
+	code := "other"
+	if _, ok := cher.DefaultCatalog().Lookup(err.Code); ok {
+		code = err.Code
+	}
+
+	return []attribute.KeyValue{
+		attribute.String("crpc.status_class", fmt.Sprintf("%dxx", err.StatusCode()/100)),
+		attribute.String("crpc.cher_code", code),
+	}
+}
+
+func mustInstrument[T any](val T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+
+	return val
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+
+	n int64
+}
+
+func (r *countingReadCloser) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.n += int64(n)
+	return n, err
+}
+
+type countingResponseWriter struct {
+	http.ResponseWriter
+
+	n int64
+}
+
+func (w *countingResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *countingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,94 @@
+package crpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMetrics(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(provider)
+	defer otel.SetMeterProvider(previous)
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Use(Metrics())
+	rpc.Register("ping", "2019-01-01", nil, func(context.Context) (*testResponse, error) {
+		return &testResponse{Message: "pong"}, nil
+	})
+	rpc.Register("fail", "2019-01-01", nil, func(context.Context) error {
+		return cher.New("failed", nil)
+	})
+	rpc.Register("missing", "2019-01-01", nil, func(context.Context) error {
+		return cher.New(cher.NotFound, nil)
+	})
+
+	for _, path := range []string{"/latest/ping", "/2019-01-01/fail", "/2019-01-01/missing"} {
+		r, _ := http.NewRequestWithContext(ctx, http.MethodPost, path, strings.NewReader(""))
+		rpc.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	var rm metricdata.ResourceMetrics
+	is.NoErr(reader.Collect(ctx, &rm))
+	is.Equal(len(rm.ScopeMetrics), 1)
+
+	metrics := map[string]metricdata.Metrics{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+
+	calls := metrics["rpc.server.calls"].Data.(metricdata.Sum[int64]) //nolint:forcetypeassert // required for test
+	is.Equal(len(calls.DataPoints), 3)
+
+	for _, dp := range calls.DataPoints {
+		method, _ := dp.Attributes.Value("rpc.method")
+		version, _ := dp.Attributes.Value("rpc.version")
+		resolved, _ := dp.Attributes.Value("crpc.resolved_version")
+		outcome, _ := dp.Attributes.Value("crpc.outcome")
+		code, hasCode := dp.Attributes.Value("crpc.cher_code")
+		class, _ := dp.Attributes.Value("crpc.status_class")
+
+		switch method.AsString() {
+		case "ping":
+			is.Equal(version.AsString(), "latest")
+			is.Equal(resolved.AsString(), "2019-01-01")
+			is.Equal(outcome.AsString(), "success")
+			is.True(!hasCode)
+		case "fail":
+			is.Equal(outcome.AsString(), "error")
+			is.Equal(code, attribute.StringValue("other")) // unregistered codes aren't labels
+			is.Equal(class, attribute.StringValue("4xx"))
+		case "missing":
+			is.Equal(code, attribute.StringValue(cher.NotFound))
+			is.Equal(class, attribute.StringValue("4xx"))
+		default:
+			t.Fatalf("unexpected method %q", method.AsString())
+		}
+	}
+
+	responseSize := metrics["rpc.server.response.size"].Data.(metricdata.Histogram[int64]) //nolint:forcetypeassert // required for test
+	for _, dp := range responseSize.DataPoints {
+		if method, _ := dp.Attributes.Value("rpc.method"); method.AsString() == "ping" {
+			is.Equal(dp.Sum, int64(len(`{"message":"pong"}`+"\n")))
+		}
+	}
+
+	duration := metrics["rpc.server.call.duration"].Data.(metricdata.Histogram[float64]) //nolint:forcetypeassert // required for test
+	is.Equal(duration.DataPoints[0].Bounds, durationBuckets)
+}
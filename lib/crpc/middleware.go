@@ -52,6 +52,10 @@ func Logger() MiddlewareFunc {
 				err = cher.New(cher.ContextCanceled, nil)
 			}
 
+			if mbErr, ok := errors.AsType[*http.MaxBytesError](err); ok {
+				err = requestTooLarge(mbErr.Limit)
+			}
+
 			clog.SetError(ctx, err)
 
 			return err
@@ -95,12 +99,38 @@ func Validate(schema *gojsonschema.Schema) MiddlewareFunc {
 	}
 }
 
+// MustCompileSchema compiles a JSON schema, panicking if it is invalid.
+func MustCompileSchema(loader gojsonschema.JSONLoader) *gojsonschema.Schema {
+	schema, err := gojsonschema.NewSchemaLoader().Compile(loader)
+	if err != nil {
+		panic(err)
+	}
+
+	return schema
+}
+
+// ValidateRequest applies the same JSON Schema validation as Validate to a
+// request body before it is sent, so clients can reject invalid requests
+// without a round trip.
+func ValidateRequest(schema *gojsonschema.Schema, src any) error {
+	result, err := schema.Validate(gojsonschema.NewGoLoader(src))
+	if err != nil {
+		return err
+	}
+
+	return CoerceJSONSchemaError(result)
+}
+
 func CoerceJSONSchemaError(result *gojsonschema.Result) error {
 	if result.Valid() {
 		return nil
 	}
 
-	return cher.New(cher.BadRequest, nil, slicefn.Map(result.Errors(), func(err gojsonschema.ResultError) cher.E {
+	return cher.New(cher.BadRequest, nil, jsonSchemaFailures(result)...)
+}
+
+func jsonSchemaFailures(result *gojsonschema.Result) []cher.E {
+	return slicefn.Map(result.Errors(), func(err gojsonschema.ResultError) cher.E {
 		return cher.E{
 			Code: "schema_failure",
 			Meta: cher.M{
@@ -109,5 +139,5 @@ func CoerceJSONSchemaError(result *gojsonschema.Result) error {
 				"message": err.Description(),
 			},
 		}
-	})...)
+	})
 }
@@ -0,0 +1,388 @@
+//nolint:tagliatelle // OpenAPI uses camel case
+package crpc
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wearemojo/mojo-public-go/lib/merr"
+	"github.com/wearemojo/mojo-public-go/lib/mlog"
+	"github.com/wearemojo/mojo-public-go/lib/servicecontext"
+	"github.com/wearemojo/mojo-public-go/lib/version"
+)
+
+// OpenAPIVersion is the version of the OpenAPI specification documents are
+// generated for.
+const OpenAPIVersion = "3.1.0"
+
+const errorSchemaRef = "#/components/schemas/Error"
+
+// OpenAPIDocument is an OpenAPI document describing every resolved method of a
+// Server. Only the parts of the specification used by crpc are modelled.
+type OpenAPIDocument struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       OpenAPIInfo                `json:"info"`
+	Paths      map[string]OpenAPIPathItem `json:"paths"`
+	Components OpenAPIComponents          `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenAPIPathItem struct {
+	Post OpenAPIOperation `json:"post"`
+}
+
+//nolint:gocritic // OpenAPI requires absent fields to be omitted
+type OpenAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Tags        []string                   `json:"tags"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+	Deprecated  bool                       `json:"deprecated,omitempty"`
+
+	// Version is the version the method was requested with in the path, and
+	// ResolvedVersion the version the handler was registered with
+	Version         string `json:"x-crpc-version"`
+	ResolvedVersion string `json:"x-crpc-resolved-version"`
+
+	// AuthPolicy is the name of the auth policy of the method, if any
+	AuthPolicy string `json:"x-crpc-auth-policy,omitempty"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+//nolint:gocritic // OpenAPI requires absent fields to be omitted
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema any `json:"schema"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]any `json:"schemas"`
+}
+
+const jsonContentType = "application/json"
+
+// OpenAPI generates an OpenAPI document from the methods registered on the
+// server. Request bodies are described by the registered JSON schemas, and
+// response bodies are reflected from the response types of wrapped functions.
+// It fails if a registered schema can't be loaded.
+func (s *Server) OpenAPI(ctx context.Context) (*OpenAPIDocument, error) {
+	doc := &OpenAPIDocument{
+		OpenAPI: OpenAPIVersion,
+		Info: OpenAPIInfo{
+			Title:   "crpc",
+			Version: version.Truncated,
+		},
+		Paths: map[string]OpenAPIPathItem{},
+		Components: OpenAPIComponents{
+			Schemas: map[string]any{
+				"Error": errorSchema(),
+			},
+		},
+	}
+
+	now := time.Now()
+
+	for requestedVersion, methodSet := range s.resolvedMethods {
+		for method, handler := range methodSet {
+			if handler == nil {
+				continue
+			}
+
+			op, err := handler.openAPIOperation(ctx, method, requestedVersion)
+			if err != nil {
+				return nil, err
+			}
+
+			// scheduled deprecations only show once they take effect
+			if d, ok := s.deprecation(requestedVersion, method); ok {
+				op.Deprecated = !now.Before(d.DeprecatedAt)
+			}
+
+			doc.Paths["/"+requestedVersion+"/"+method] = OpenAPIPathItem{Post: op}
+		}
+	}
+
+	return doc, nil
+}
+
+// OpenAPIHandler returns an HTTP handler serving the OpenAPI document of the
+// server, typically mounted at `/openapi.json`. The document title is taken
+// from the service context when one is present.
+func (s *Server) OpenAPIHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		doc, err := s.OpenAPI(ctx)
+		if err != nil {
+			s.writeError(ctx, w, r, err)
+			return
+		}
+
+		if svc := servicecontext.GetContext(ctx); svc != nil {
+			doc.Info.Title = svc.Service
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(doc); err != nil {
+			mlog.Warn(ctx, merr.New(ctx, "crpc_openapi_write_failed", nil, err))
+		}
+	})
+}
+
+func (h *wrappedHandler) openAPIOperation(ctx context.Context, method, requestedVersion string) (OpenAPIOperation, error) {
+	op := OpenAPIOperation{
+		OperationID: method + "_" + strings.ReplaceAll(requestedVersion, "-", ""),
+		Tags:        []string{method},
+		Responses: map[string]OpenAPIResponse{
+			"default": {
+				Description: "error",
+				Content: map[string]OpenAPIMediaType{
+					jsonContentType: {Schema: map[string]any{"$ref": errorSchemaRef}},
+				},
+			},
+		},
+
+		Version:         requestedVersion,
+		ResolvedVersion: h.v,
+		AuthPolicy:      h.opts.authPolicyName(),
+	}
+
+	if h.schema != nil {
+		schema, err := h.schema.LoadJSON()
+		if err != nil {
+			return op, merr.New(ctx, "openapi_schema_load_failed", merr.M{"method": method, "version": h.v}, err)
+		}
+
+		op.RequestBody = &OpenAPIRequestBody{
+			Required: true,
+			Content: map[string]OpenAPIMediaType{
+				jsonContentType: {Schema: schema},
+			},
+		}
+	}
+
+	switch {
+	case h.opts.responseSchema.loader != nil:
+		schema, err := h.opts.responseSchema.loader.LoadJSON()
+		if err != nil {
+			return op, merr.New(ctx, "openapi_response_schema_load_failed", merr.M{"method": method, "version": h.v}, err)
+		}
+
+		op.Responses["200"] = OpenAPIResponse{
+			Description: "success",
+			Content: map[string]OpenAPIMediaType{
+				jsonContentType: {Schema: schema},
+			},
+		}
+
+	case h.wrapped == nil:
+		// registered with RegisterFunc, so nothing is known about the response
+		op.Responses["200"] = OpenAPIResponse{
+			Description: "success",
+			Content: map[string]OpenAPIMediaType{
+				jsonContentType: {Schema: map[string]any{}},
+			},
+		}
+
+	case h.wrapped.ResponseType == nil:
+		op.Responses["204"] = OpenAPIResponse{Description: "success"}
+
+	case h.wrapped.StreamItemType != nil:
+		itemSchema := reflectSchema(h.wrapped.StreamItemType, map[reflect.Type]bool{})
+
+		op.Responses["200"] = OpenAPIResponse{
+			Description: "success, streamed",
+			Content: map[string]OpenAPIMediaType{
+				ContentTypeNDJSON: {Schema: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"item":  itemSchema,
+						"error": map[string]any{"$ref": errorSchemaRef},
+						"done":  map[string]any{"type": "boolean"},
+					},
+				}},
+				ContentTypeEventStream: {Schema: itemSchema},
+			},
+		}
+
+	default:
+		op.Responses["200"] = OpenAPIResponse{
+			Description: "success",
+			Content: map[string]OpenAPIMediaType{
+				jsonContentType: {Schema: reflectSchema(h.wrapped.ResponseType, map[reflect.Type]bool{})},
+			},
+		}
+	}
+
+	return op, nil
+}
+
+// errorSchema describes the cher error envelope
+func errorSchema() map[string]any {
+	return map[string]any{
+		"type":     "object",
+		"required": []string{"code"},
+		"properties": map[string]any{
+			"code": map[string]any{"type": "string"},
+			"meta": map[string]any{"type": "object"},
+			"reasons": map[string]any{
+				"type":  "array",
+				"items": map[string]any{"$ref": errorSchemaRef},
+			},
+		},
+	}
+}
+
+var (
+	timeType           = reflect.TypeFor[time.Time]()
+	jsonMarshalerType  = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType  = reflect.TypeFor[encoding.TextMarshaler]()
+	rawJSONMessageType = reflect.TypeFor[json.RawMessage]()
+)
+
+// reflectSchema produces a JSON schema for a Go type following the rules of
+// encoding/json. Types with custom marshaling are described as accepting
+// anything, as their output cannot be determined through reflection.
+func reflectSchema(typ reflect.Type, seen map[reflect.Type]bool) map[string]any {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	switch {
+	case typ == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case typ == rawJSONMessageType:
+		return map[string]any{}
+	case typ.Implements(jsonMarshalerType), reflect.PointerTo(typ).Implements(jsonMarshalerType):
+		return map[string]any{}
+	case typ.Implements(textMarshalerType), reflect.PointerTo(typ).Implements(textMarshalerType):
+		return map[string]any{"type": "string"}
+	}
+
+	switch typ.Kind() { //nolint:exhaustive // remaining kinds are not JSON serializable
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+
+	case
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+
+	case reflect.String:
+		return map[string]any{"type": "string"}
+
+	case reflect.Slice, reflect.Array:
+		if typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+
+		return map[string]any{"type": "array", "items": reflectSchema(typ.Elem(), seen)}
+
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": reflectSchema(typ.Elem(), seen)}
+
+	case reflect.Struct:
+		if seen[typ] {
+			// recursive types are left open rather than expanded forever
+			return map[string]any{"type": "object"}
+		}
+
+		seen[typ] = true
+		defer delete(seen, typ)
+
+		properties := map[string]any{}
+		required := []string{}
+		reflectStructFields(typ, seen, properties, &required)
+		sort.Strings(required)
+
+		return map[string]any{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		}
+
+	default:
+		return map[string]any{}
+	}
+}
+
+func reflectStructFields(typ reflect.Type, seen map[reflect.Type]bool, properties map[string]any, required *[]string) {
+	for _, field := range jsonFields(typ) {
+		schema := reflectSchema(field.typ, seen)
+		if field.hasOption("string") && quotable(field.typ) {
+			schema = map[string]any{"type": "string"}
+		}
+
+		if !field.hasOption("omitempty") && !field.hasOption("omitzero") {
+			*required = append(*required, field.name)
+
+			// nil values are written as null rather than omitted
+			switch field.typ.Kind() { //nolint:exhaustive // other kinds can't be nil
+			case reflect.Pointer, reflect.Slice, reflect.Map:
+				schema = nullable(schema)
+			}
+		}
+
+		properties[field.name] = schema
+	}
+}
+
+// quotable reports whether encoding/json applies the `string` option to
+// values of typ, writing them as JSON strings
+func quotable(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() { //nolint:exhaustive // the option is ignored for other kinds
+	case
+		reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	default:
+		return false
+	}
+}
+
+// nullable allows null in place of the values schema describes. Schemas
+// without a type already allow anything.
+func nullable(schema map[string]any) map[string]any {
+	typ, ok := schema["type"].(string)
+	if !ok {
+		return schema
+	}
+
+	schema["type"] = []string{typ, "null"}
+
+	return schema
+}
@@ -0,0 +1,177 @@
+package crpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/wearemojo/mojo-public-go/lib/merr"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+type openAPITestEmbedded struct {
+	Embedded string `json:"embedded"`
+
+	// shadowed by the field of the outer struct, although declared first
+	Count string `json:"count"`
+}
+
+type openAPITestResponse struct {
+	openAPITestEmbedded
+
+	Name      string            `json:"name"`
+	Count     int               `json:"count"`
+	Tags      []string          `json:"tags"`
+	Labels    map[string]string `json:"labels"`
+	Score     *int64            `json:"score,string"`
+	Retries   int               `json:"retries,omitempty,string"`
+	Blocks    []int             `json:"blocks,string"`
+	CreatedAt time.Time         `json:"created_at"`
+	Child     *openAPITestChild `json:"child,omitempty"` //nolint:gocritic // needed for testing
+	Ignored   string            `json:"-"`
+
+	hidden string
+}
+
+type openAPITestChild struct {
+	Parent *openAPITestChild `json:"parent"`
+}
+
+func TestOpenAPI(t *testing.T) {
+	is := is.New(t)
+
+	schema := gojsonschema.NewStringLoader(`{
+		"type": "object",
+		"required": [ "name" ],
+		"properties": {
+			"name": { "type": "string" }
+		}
+	}`)
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("ping", "2019-01-01", nil, func(context.Context) error { return nil })
+	rpc.Register("get_thing", "2019-02-02", schema, func(context.Context, *struct{}) (*openAPITestResponse, error) {
+		return &openAPITestResponse{hidden: "hidden"}, nil
+	})
+
+	doc, err := rpc.OpenAPI(t.Context())
+	is.NoErr(err)
+
+	is.Equal(doc.OpenAPI, "3.1.0")
+	is.Equal(len(doc.Paths), 5) // ping x3 (including latest), get_thing x2
+
+	ping := doc.Paths["/2019-02-02/ping"].Post
+	is.Equal(ping.ResolvedVersion, "2019-01-01")
+	is.Equal(ping.RequestBody, nil)
+	is.Equal(ping.Responses["204"].Description, "success")
+
+	getThing := doc.Paths["/latest/get_thing"].Post
+	is.Equal(getThing.Version, "latest")
+	is.Equal(getThing.ResolvedVersion, "2019-02-02")
+	is.True(getThing.RequestBody.Required)
+
+	reqSchema, ok := getThing.RequestBody.Content["application/json"].Schema.(map[string]any)
+	is.True(ok)
+	is.Equal(reqSchema["required"], []any{"name"})
+
+	resSchema, ok := getThing.Responses["200"].Content["application/json"].Schema.(map[string]any)
+	is.True(ok)
+	is.Equal(resSchema["required"], []string{"blocks", "count", "created_at", "embedded", "labels", "name", "score", "tags"})
+
+	properties, ok := resSchema["properties"].(map[string]any)
+	is.True(ok)
+	is.Equal(len(properties), 10)
+	is.Equal(properties["count"], map[string]any{"type": "integer"}) // the shallowest field wins
+	is.Equal(properties["created_at"], map[string]any{"type": "string", "format": "date-time"})
+
+	// nil pointers, slices and maps are written as null
+	is.Equal(properties["tags"], map[string]any{"type": []string{"array", "null"}, "items": map[string]any{"type": "string"}})
+	is.Equal(properties["labels"], map[string]any{"type": []string{"object", "null"}, "additionalProperties": map[string]any{"type": "string"}})
+	is.Equal(properties["child"], map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"parent": map[string]any{"type": []string{"object", "null"}}},
+		"required":   []string{"parent"},
+	})
+
+	// the string option quotes numbers, and is ignored for other kinds
+	is.Equal(properties["score"], map[string]any{"type": []string{"string", "null"}})
+	is.Equal(properties["retries"], map[string]any{"type": "string"})
+	is.Equal(properties["blocks"], map[string]any{"type": []string{"array", "null"}, "items": map[string]any{"type": "integer"}})
+
+	is.Equal(getThing.Responses["default"].Content["application/json"].Schema, map[string]any{"$ref": "#/components/schemas/Error"})
+}
+
+func TestOpenAPIDeprecated(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Now()
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("ping", "2019-01-01", nil, func(context.Context) error { return nil })
+	rpc.Register("pong", "2019-01-01", nil, func(context.Context) error { return nil })
+	rpc.Deprecate("2019-01-01", Deprecation{DeprecatedAt: now.Add(-time.Hour)}, "ping")
+	rpc.Deprecate("2019-01-01", Deprecation{DeprecatedAt: now.Add(time.Hour)}, "pong")
+
+	doc, err := rpc.OpenAPI(t.Context())
+	is.NoErr(err)
+
+	is.True(doc.Paths["/2019-01-01/ping"].Post.Deprecated)
+	is.True(!doc.Paths["/2019-01-01/pong"].Post.Deprecated) // not deprecated yet
+}
+
+func TestOpenAPISchemaLoadFailure(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "schema.json")
+	is.NoErr(os.WriteFile(path, []byte(`{"type": "object"}`), 0o600))
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("ping", "2019-01-01", gojsonschema.NewReferenceLoader("file://"+path), func(context.Context, *struct{}) error { return nil })
+
+	// the schema was compiled at registration, but can no longer be loaded
+	is.NoErr(os.Remove(path))
+
+	_, err := rpc.OpenAPI(t.Context())
+	is.True(err != nil)
+
+	merrErr, ok := errors.AsType[merr.E](err)
+	is.True(ok)
+	is.Equal(merrErr.Code, merr.Code("openapi_schema_load_failed"))
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+
+	rpc.OpenAPIHandler().ServeHTTP(rec, r)
+
+	is.Equal(rec.Code, http.StatusInternalServerError)
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("ping", "2019-01-01", nil, func(context.Context) error { return nil })
+
+	rec := httptest.NewRecorder()
+	r, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/openapi.json", nil)
+
+	rpc.OpenAPIHandler().ServeHTTP(rec, r)
+
+	is.Equal(rec.Code, http.StatusOK)
+
+	var doc map[string]any
+	is.NoErr(json.Unmarshal(rec.Body.Bytes(), &doc))
+	is.Equal(doc["openapi"], "3.1.0")
+}
@@ -0,0 +1,164 @@
+package crpc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// RegisterOption configures a method as it is registered with
+// RegisterWithOptions or RegisterFuncWithOptions. MiddlewareFunc is a
+// RegisterOption which adds the middleware to the method.
+type RegisterOption interface {
+	applyRegisterOption(opts *registerOptions)
+}
+
+// registerOptions is the configuration of a method built from its
+// RegisterOptions
+type registerOptions struct {
+	middleware []MiddlewareFunc
+
+	timeout time.Duration
+
+	responseSchema loaderSchema
+
+	maxBodySize    int64
+	strictDecoding bool
+
+	authPolicy *authPolicy
+}
+
+func (fn MiddlewareFunc) applyRegisterOption(opts *registerOptions) {
+	opts.middleware = append(opts.middleware, fn)
+}
+
+func middlewareOptions(middleware []MiddlewareFunc) []RegisterOption {
+	opts := make([]RegisterOption, len(middleware))
+	for i, mw := range middleware {
+		opts[i] = mw
+	}
+
+	return opts
+}
+
+type registerOptionFunc func(opts *registerOptions)
+
+func (fn registerOptionFunc) applyRegisterOption(opts *registerOptions) {
+	fn(opts)
+}
+
+func buildRegisterOptions(opts []RegisterOption) *registerOptions {
+	o := &registerOptions{}
+
+	for _, opt := range opts {
+		opt.applyRegisterOption(o)
+	}
+
+	return o
+}
+
+// WithTimeout limits how long the method may run for. Once the timeout has
+// passed, the request context is cancelled and the method fails with
+// cher.RequestTimeout. The timeout only shortens the deadline set by the
+// caller, if any.
+func WithTimeout(timeout time.Duration) RegisterOption {
+	if timeout <= 0 {
+		panic("timeout must be positive")
+	}
+
+	return registerOptionFunc(func(opts *registerOptions) {
+		opts.timeout = timeout
+	})
+}
+
+// WithMaxBodySize limits the size of request bodies in bytes, overriding the
+// server's MaxBodySize. Larger requests fail with cher.RequestTooLarge.
+func WithMaxBodySize(size int64) RegisterOption {
+	if size <= 0 {
+		panic("max body size must be positive")
+	}
+
+	return registerOptionFunc(func(opts *registerOptions) {
+		opts.maxBodySize = size
+	})
+}
+
+// WithStrictDecoding rejects request bodies with fields the request type
+// doesn't have, as if the server's StrictDecoding was set for the method.
+func WithStrictDecoding() RegisterOption {
+	return registerOptionFunc(func(opts *registerOptions) {
+		opts.strictDecoding = true
+	})
+}
+
+// PublicAuthPolicy is the name shown for methods registered with Public.
+const PublicAuthPolicy = "public"
+
+// authPolicy is the authorization policy of a method
+type authPolicy struct {
+	name       string
+	middleware MiddlewareFunc
+}
+
+// WithAuthPolicy authorizes calls to the method with middleware, which runs
+// after authentication and request validation, before any other middleware.
+// The name describes the policy in introspection and the OpenAPI document.
+//
+// Only one policy can be set for a method, and it can't also be Public.
+func WithAuthPolicy(name string, middleware MiddlewareFunc) RegisterOption {
+	if name == "" || name == PublicAuthPolicy {
+		panic(fmt.Sprintf("invalid auth policy name %q", name))
+	} else if middleware == nil {
+		panic("auth policy middleware is nil")
+	}
+
+	return registerOptionFunc(func(opts *registerOptions) {
+		opts.setAuthPolicy(&authPolicy{name, middleware})
+	})
+}
+
+// Public marks the method as callable by anyone who passes the server's
+// AuthenticationMiddleware, with no further authorization. Methods need
+// either this or WithAuthPolicy, so being public is a deliberate choice.
+func Public() RegisterOption {
+	return registerOptionFunc(func(opts *registerOptions) {
+		opts.setAuthPolicy(&authPolicy{name: PublicAuthPolicy})
+	})
+}
+
+func (o registerOptions) authPolicyName() string {
+	if o.authPolicy == nil {
+		return ""
+	}
+
+	return o.authPolicy.name
+}
+
+func (o *registerOptions) setAuthPolicy(policy *authPolicy) {
+	if o.authPolicy != nil {
+		panic(fmt.Sprintf("auth policy %q already set, cannot set %q", o.authPolicy.name, policy.name))
+	}
+
+	o.authPolicy = policy
+}
+
+// WithResponseSchema validates responses against a JSON schema, which is also
+// used to describe them in the OpenAPI document. Invalid responses fail with
+// cher.Unknown outside of production, and are logged in production.
+func WithResponseSchema(schema gojsonschema.JSONLoader) RegisterOption {
+	compiled, err := gojsonschema.NewSchemaLoader().Compile(schema)
+	if err != nil {
+		panic(fmt.Sprintf("response json schema error: %s", err))
+	}
+
+	return registerOptionFunc(func(opts *registerOptions) {
+		opts.responseSchema = loaderSchema{schema, compiled}
+	})
+}
+
+// loaderSchema keeps a compiled schema along with the loader it came from
+type loaderSchema struct {
+	loader   gojsonschema.JSONLoader
+	compiled *gojsonschema.Schema
+}
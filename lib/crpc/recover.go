@@ -0,0 +1,60 @@
+package crpc
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/wearemojo/mojo-public-go/lib/clog"
+	"github.com/wearemojo/mojo-public-go/lib/merr"
+)
+
+// ErrHandlerPanicked is the code of the error returned by Recover for panics.
+const ErrHandlerPanicked = merr.Code("crpc_handler_panicked")
+
+// Recover catches panics in the wrapped HandlerFunc and returns them as a
+// merr.E with the panic value and the stack of the panic, which is recorded on
+// the context logger. Callers receive cher.Unknown with a 500, as for any other
+// unexpected error, rather than a dropped connection. Like Logger, it requires a
+// context logger.
+//
+// It should be used after Logger, so the error is logged with the request.
+func Recover() MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(res http.ResponseWriter, req *Request) (err error) {
+			defer func() {
+				val := recover()
+				if val == nil {
+					return
+				}
+
+				// http.ErrAbortHandler is used to deliberately abort a response
+				if val == http.ErrAbortHandler { //nolint:errorlint,err113 // compared as net/http does
+					panic(val)
+				}
+
+				err = panicError(req, val)
+				clog.SetError(req.Context(), err)
+			}()
+
+			return next(res, req)
+		}
+	}
+}
+
+// panicError must be called from the deferred function which recovered, so
+// the stack of the panic is still available
+func panicError(req *Request, val any) merr.E {
+	ctx := req.Context()
+
+	meta := merr.M{
+		"method":  req.Method,
+		"version": req.Version,
+		"panic":   fmt.Sprint(val),
+	}
+
+	if err, ok := val.(error); ok {
+		return merr.New(ctx, ErrHandlerPanicked, meta, err)
+	}
+
+	return merr.New(ctx, ErrHandlerPanicked, meta)
+}
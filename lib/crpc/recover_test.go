@@ -0,0 +1,55 @@
+package crpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/sirupsen/logrus"
+	"github.com/wearemojo/mojo-public-go/lib/clog"
+	"github.com/wearemojo/mojo-public-go/lib/merr"
+)
+
+func panickingHandler(context.Context) error {
+	panic("something went wrong")
+}
+
+func TestRecover(t *testing.T) {
+	is := is.New(t)
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Use(Logger())
+	rpc.Use(Recover())
+	rpc.Register("explode", "2019-01-01", nil, panickingHandler)
+
+	ctx := clog.Set(t.Context(), logrus.NewEntry(logrus.New()))
+
+	rec := httptest.NewRecorder()
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/2019-01-01/explode", nil)
+
+	rpc.ServeHTTP(rec, r)
+
+	is.Equal(rec.Code, http.StatusInternalServerError)
+	is.Equal(strings.TrimSpace(rec.Body.String()), `{"code":"unknown"}`)
+
+	logged, ok := clog.Get(ctx).Data[logrus.ErrorKey].(error)
+	is.True(ok)
+
+	var merrErr merr.E
+	is.True(errors.As(logged, &merrErr))
+	is.Equal(merrErr.Code, ErrHandlerPanicked)
+	is.Equal(merrErr.Meta["panic"], "something went wrong")
+
+	var panicFrame bool
+	for _, frame := range merrErr.Stack {
+		if strings.HasSuffix(frame.Function, "panickingHandler") {
+			panicFrame = true
+		}
+	}
+	is.True(panicFrame) // stack includes where the panic happened
+}
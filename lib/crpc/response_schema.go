@@ -0,0 +1,79 @@
+package crpc
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/ksuid"
+	"github.com/wearemojo/mojo-public-go/lib/merr"
+	"github.com/wearemojo/mojo-public-go/lib/mlog"
+	"github.com/wearemojo/mojo-public-go/lib/servicecontext"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// validateResponse buffers the response of a method and validates it against
+// schema before writing it. Invalid responses fail the request outside of
+// production, so mistakes are caught before clients see them, and are only
+// logged in production, where the service context is missing or its
+// environment is ksuid.Production.
+func validateResponse(schema *gojsonschema.Schema) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(res http.ResponseWriter, req *Request) error {
+			ctx := req.Context()
+
+			w := &bufferedResponseWriter{ResponseWriter: res}
+			if err := next(w, req); err != nil {
+				return err
+			}
+
+			body := w.body.Bytes()
+			if len(bytes.TrimSpace(body)) == 0 {
+				body = []byte("null")
+			}
+
+			result, err := schema.Validate(gojsonschema.NewBytesLoader(body))
+			if err != nil {
+				return merr.New(ctx, "response_body_validation_failed", nil, err)
+			}
+
+			if !result.Valid() {
+				cerr := cher.New("invalid_response", nil, jsonSchemaFailures(result)...)
+
+				if svc := servicecontext.GetContext(ctx); svc != nil && svc.Env != ksuid.Production {
+					return cher.New(cher.Unknown, nil, cerr)
+				}
+
+				mlog.Warn(ctx, merr.New(ctx, "crpc_response_schema_failure", merr.M{
+					"method":  req.Method,
+					"version": req.Version,
+				}, cerr))
+			}
+
+			if w.status != 0 {
+				res.WriteHeader(w.status)
+			}
+
+			_, err = res.Write(w.body.Bytes())
+			return err
+		}
+	}
+}
+
+// bufferedResponseWriter holds back the response until it has been checked
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
@@ -0,0 +1,86 @@
+package crpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/wearemojo/mojo-public-go/lib/servicecontext"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+type responseSchemaTestResponse struct {
+	Name string `json:"name"`
+}
+
+func TestResponseSchema(t *testing.T) {
+	schema := gojsonschema.NewStringLoader(`{
+		"type": "object",
+		"required": ["name"],
+		"properties": {
+			"name": {"type": "string", "minLength": 1}
+		}
+	}`)
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.RegisterWithOptions("valid", "2019-01-01", nil, func(context.Context) (*responseSchemaTestResponse, error) {
+		return &responseSchemaTestResponse{Name: "mojo"}, nil
+	}, WithResponseSchema(schema))
+	rpc.RegisterWithOptions("invalid", "2019-01-01", nil, func(context.Context) (*responseSchemaTestResponse, error) {
+		return &responseSchemaTestResponse{}, nil
+	}, WithResponseSchema(schema))
+
+	do := func(t *testing.T, env, method string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		ctx := servicecontext.SetContext(t.Context(), servicecontext.Info{Env: env})
+
+		rec := httptest.NewRecorder()
+		r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/2019-01-01/"+method, nil)
+
+		rpc.ServeHTTP(rec, r)
+
+		return rec
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		is := is.New(t)
+
+		rec := do(t, "test", "valid")
+
+		is.Equal(rec.Code, http.StatusOK)
+		is.Equal(strings.TrimSpace(rec.Body.String()), `{"name":"mojo"}`)
+	})
+
+	t.Run("InvalidOutsideProduction", func(t *testing.T) {
+		is := is.New(t)
+
+		rec := do(t, "test", "invalid")
+
+		is.Equal(rec.Code, http.StatusInternalServerError)
+		is.True(strings.Contains(rec.Body.String(), `"code":"invalid_response"`))
+	})
+
+	t.Run("InvalidInProduction", func(t *testing.T) {
+		is := is.New(t)
+
+		rec := do(t, "prod", "invalid")
+
+		is.Equal(rec.Code, http.StatusOK)
+		is.Equal(strings.TrimSpace(rec.Body.String()), `{"name":""}`)
+	})
+
+	t.Run("OpenAPI", func(t *testing.T) {
+		is := is.New(t)
+
+		doc, err := rpc.OpenAPI(t.Context())
+		is.NoErr(err)
+
+		res := doc.Paths["/2019-01-01/valid"].Post.Responses["200"]
+		is.Equal(res.Content[jsonContentType].Schema.(map[string]any)["required"], []any{"name"}) //nolint:forcetypeassert // required for test
+	})
+}
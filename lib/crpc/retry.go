@@ -0,0 +1,284 @@
+package crpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RetryPolicy configures how a Client retries calls which failed for
+// transient reasons: transport errors, and 429, 502, 503 and 504 responses.
+//
+// Only calls which are safe to repeat are retried, being calls to methods in
+// SafeMethods and calls made with an IdempotencyKeyHeader.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts made, including the first.
+	// Defaults to 3.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry, which is multiplied
+	// by Multiplier for each retry after it, up to MaxBackoff. Defaults to
+	// 100ms, 2 and 5s respectively.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// Jitter is the fraction of each delay which is randomised, to avoid
+	// clients retrying in lockstep. Defaults to 0.2.
+	Jitter float64
+
+	// MaxElapsedTime stops retries once the next attempt would start this long
+	// after the first. Defaults to 30s.
+	MaxElapsedTime time.Duration
+
+	// SafeMethods are the methods which can be retried without an idempotency
+	// key, as calling them again has no further effect.
+	SafeMethods []string
+}
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 5 * time.Second
+	defaultRetryMultiplier     = 2
+	defaultRetryJitter         = 0.2
+	defaultRetryMaxElapsedTime = 30 * time.Second
+)
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = defaultRetryMultiplier
+	}
+	if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = defaultRetryJitter
+	}
+	if p.MaxElapsedTime <= 0 {
+		p.MaxElapsedTime = defaultRetryMaxElapsedTime
+	}
+
+	return p
+}
+
+// backoff returns the delay before a retry, where retry is 1 for the first
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := float64(p.InitialBackoff)
+	for range retry - 1 {
+		delay *= p.Multiplier
+		if delay >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+
+	delay = min(delay, float64(p.MaxBackoff))
+
+	return time.Duration(delay * (1 - p.Jitter*rand.Float64())) //nolint:gosec // jitter doesn't need to be secure
+}
+
+// UseRetryPolicy retries calls made with Do according to policy. Streams are
+// never retried, as items may already have been yielded.
+func (c *Client) UseRetryPolicy(policy RetryPolicy) {
+	policy = policy.withDefaults()
+	c.retry = &policy
+	c.recordResponses()
+}
+
+// recordResponses wraps the transport of the client with a responseRecorder,
+// as the status and headers of failed responses are needed to decide what to
+// do about them, but jsonclient only returns their body
+func (c *Client) recordResponses() {
+	if _, ok := c.client.Client.Transport.(responseRecorder); ok {
+		return
+	}
+
+	hc := *c.client.Client
+	hc.Transport = responseRecorder{next: hc.Transport}
+	c.client.Client = &hc
+}
+
+func (c *Client) doWithRetry(ctx context.Context, method, version string, src, dst any, requestModifiers []func(r *http.Request)) error {
+	policy := c.retry
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+
+	var hasIdempotencyKey bool
+	requestModifiers = append(slices.Clip(requestModifiers), func(r *http.Request) {
+		hasIdempotencyKey = r.Header.Get(IdempotencyKeyHeader) != ""
+	})
+
+	for attempt := 1; ; attempt++ {
+		res := &recordedResponse{}
+		err := c.attempt(context.WithValue(ctx, recordedResponseKey, res), method, version, src, dst, requestModifiers)
+
+		attrs := []attribute.KeyValue{attribute.Int("crpc.attempt", attempt)}
+		if res.status != 0 {
+			attrs = append(attrs, attribute.Int("http.response.status_code", res.status))
+		}
+
+		if err == nil {
+			span.AddEvent("crpc.client.attempt", trace.WithAttributes(attrs...))
+			return nil
+		}
+
+		attrs = append(attrs, attribute.String("error.type", retryErrorType(err)))
+
+		safe := hasIdempotencyKey || slices.Contains(policy.SafeMethods, method)
+		delay, ok := policy.nextDelay(ctx, start, attempt, res)
+		if !ok || !safe || !isRetryable(err, res.status) {
+			span.AddEvent("crpc.client.attempt", trace.WithAttributes(attrs...))
+			return err
+		}
+
+		attrs = append(attrs, attribute.Int64("crpc.retry_delay_ms", delay.Milliseconds()))
+		span.AddEvent("crpc.client.attempt", trace.WithAttributes(attrs...))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// nextDelay returns the delay before the next attempt, or false if there is
+// no time or attempt left for it
+func (p RetryPolicy) nextDelay(ctx context.Context, start time.Time, attempt int, res *recordedResponse) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts || ctx.Err() != nil {
+		return 0, false
+	}
+
+	now := time.Now()
+
+	delay := p.backoff(attempt)
+	if retryAfter, ok := parseRetryAfter(res.header, now); ok {
+		delay = retryAfter
+	}
+
+	if now.Sub(start)+delay > p.MaxElapsedTime {
+		return 0, false
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		return 0, false
+	}
+
+	return delay, true
+}
+
+// isRetryable reports whether a call failed for a reason which may not
+// happen again
+func isRetryable(err error, status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	if cerr, ok := errors.AsType[cher.E](err); ok {
+		return cerr.Code == cher.TooManyRequests
+	}
+
+	return isTransportFailure(err)
+}
+
+// isTransportFailure reports whether a call failed to reach the server or to
+// receive its response, as opposed to failing to marshal or unmarshal
+func isTransportFailure(err error) bool {
+	cte, ok := errors.AsType[ClientTransportError](err)
+	if !ok || cte.cause == nil {
+		return false
+	}
+
+	if _, ok := errors.AsType[net.Error](cte.cause); ok {
+		return true
+	}
+
+	return errors.Is(cte.cause, io.ErrUnexpectedEOF)
+}
+
+func retryErrorType(err error) string {
+	if cerr, ok := errors.AsType[cher.E](err); ok {
+		return cerr.Code
+	}
+
+	if _, ok := errors.AsType[ClientTransportError](err); ok {
+		return "transport_error"
+	}
+
+	return "unknown"
+}
+
+// parseRetryAfter parses the Retry-After header, which is either a number of
+// seconds or an HTTP date
+func parseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+
+	return 0, false
+}
+
+const recordedResponseKey contextKey = "crpcrecordedresponse"
+
+// recordedResponse is the status and headers of the response to an attempt
+type recordedResponse struct {
+	status int
+	header http.Header
+}
+
+// responseRecorder records responses into the recordedResponse of the
+// request context, if there is one
+type responseRecorder struct {
+	next http.RoundTripper
+}
+
+func (t responseRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	res, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if recorded, ok := req.Context().Value(recordedResponseKey).(*recordedResponse); ok {
+		recorded.status = res.StatusCode
+		recorded.header = res.Header
+	}
+
+	return res, nil
+}
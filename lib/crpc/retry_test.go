@@ -0,0 +1,199 @@
+package crpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// flakyServer fails the first failures requests with status, then succeeds
+func flakyServer(t *testing.T, failures int32, status int, retryAfter string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+
+			w.WriteHeader(status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"message":"pong"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &calls
+}
+
+func retryTestClient(ctx context.Context, url string) *Client {
+	client := NewClient(ctx, url, nil)
+	client.UseRetryPolicy(RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		SafeMethods:    []string{"ping"},
+	})
+
+	return client
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		failures int32
+		status   int
+		key      bool
+		calls    int32
+		success  bool
+	}{
+		{"SafeMethod", "ping", 2, http.StatusServiceUnavailable, false, 3, true},
+		{"TooManyRequests", "ping", 1, http.StatusTooManyRequests, false, 2, true},
+		{"Exhausted", "ping", 5, http.StatusBadGateway, false, 3, false},
+		{"UnsafeMethod", "create", 2, http.StatusServiceUnavailable, false, 1, false},
+		{"IdempotencyKey", "create", 2, http.StatusServiceUnavailable, true, 3, true},
+		{"NotTransient", "ping", 2, http.StatusInternalServerError, false, 1, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+			ctx := t.Context()
+
+			srv, calls := flakyServer(t, test.failures, test.status, "")
+
+			var modifiers []func(r *http.Request)
+			if test.key {
+				modifiers = append(modifiers, func(r *http.Request) {
+					r.Header.Set(IdempotencyKeyHeader, "key")
+				})
+			}
+
+			var res testResponse
+			err := retryTestClient(ctx, srv.URL).Do(ctx, test.method, "2019-01-01", nil, &res, modifiers...)
+
+			is.Equal(calls.Load(), test.calls)
+			is.Equal(err == nil, test.success)
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	srv, calls := flakyServer(t, 1, http.StatusTooManyRequests, "1")
+
+	start := time.Now()
+
+	var res testResponse
+	err := retryTestClient(ctx, srv.URL).Do(ctx, "ping", "2019-01-01", nil, &res)
+	is.NoErr(err)
+	is.Equal(calls.Load(), int32(2))
+	is.True(time.Since(start) >= time.Second)
+
+	// the deadline doesn't leave time to wait as long as asked
+	srv, calls = flakyServer(t, 1, http.StatusTooManyRequests, "60")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	err = retryTestClient(ctx, srv.URL).Do(ctx, "ping", "2019-01-01", nil, &res)
+	cerr, ok := err.(cher.E) //nolint:errorlint // required for test
+	is.True(ok)
+	is.Equal(cerr.Code, "too_many_requests")
+	is.Equal(calls.Load(), int32(1))
+}
+
+func TestRetryTransportError(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	err := retryTestClient(ctx, url).Do(ctx, "ping", "2019-01-01", nil, nil)
+
+	_, ok := err.(ClientTransportError) //nolint:errorlint // required for test
+	is.True(ok)
+}
+
+func TestRetrySpanEvents(t *testing.T) {
+	is := is.New(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	ctx, span := provider.Tracer("test").Start(t.Context(), "call")
+
+	srv, _ := flakyServer(t, 1, http.StatusServiceUnavailable, "")
+
+	var res testResponse
+	err := retryTestClient(ctx, srv.URL).Do(ctx, "ping", "2019-01-01", nil, &res)
+	is.NoErr(err)
+
+	span.End()
+
+	spans := recorder.Ended()
+	is.Equal(len(spans), 1)
+
+	events := spans[0].Events()
+	is.Equal(len(events), 2)
+	is.Equal(events[0].Name, "crpc.client.attempt")
+
+	attrs := map[string]any{}
+	for _, attr := range events[0].Attributes {
+		attrs[string(attr.Key)] = attr.Value.AsInterface()
+	}
+
+	is.Equal(attrs["crpc.attempt"], int64(1))
+	is.Equal(attrs["http.response.status_code"], int64(http.StatusServiceUnavailable))
+	is.Equal(attrs["error.type"], "service_unavailable")
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{"Missing", "", 0, false},
+		{"Seconds", "3", 3 * time.Second, true},
+		{"Negative", "-1", 0, false},
+		{"Date", now.Add(time.Minute).Format(http.TimeFormat), time.Minute, true},
+		{"PastDate", now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"Invalid", "soon", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+
+			header := http.Header{}
+			if test.value != "" {
+				header.Set("Retry-After", test.value)
+			}
+
+			delay, ok := parseRetryAfter(header, now)
+			is.Equal(delay, test.delay)
+			is.Equal(ok, test.ok)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package crpc
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -29,12 +30,24 @@ type Request struct {
 	Version string
 	Method  string
 
+	// ResolvedVersion is the version the method was registered with, which
+	// differs from Version when it was carried forward from an earlier version
+	// or requested with the latest version. It is set once the method has been
+	// resolved.
+	ResolvedVersion string
+
 	Body io.ReadCloser
 
 	RemoteAddr    string
 	BrowserOrigin string
 
 	originalRequest *http.Request
+
+	// strictDecoding is set when unknown fields must be rejected by Wrap
+	strictDecoding bool
+
+	// streaming is set when the method streams its response
+	streaming bool
 }
 
 func (r *Request) Context() context.Context {
@@ -71,6 +84,14 @@ type WrappedFunc struct {
 	Handler           HandlerFunc
 	HasRequestInput   bool
 	HasResponseOutput bool
+
+	// ResponseType is the type of the response value returned by the function,
+	// or nil if it only returns an error
+	ResponseType reflect.Type
+
+	// StreamItemType is the type of the items yielded by functions returning
+	// an iterator, or nil if the response is not streamed
+	StreamItemType reflect.Type
 }
 
 var (
@@ -85,6 +106,12 @@ var (
 // func(ctx context.Context, request *T) (err error)
 // func(ctx context.Context) (response *T, err error)
 // func(ctx context.Context) (err error)
+//
+// Responses may also be streamed by returning an iterator of items, which are
+// written as they are yielded (see Stream):
+//
+// func(ctx context.Context, request *T) (response iter.Seq2[*T, error], err error)
+// func(ctx context.Context) (response iter.Seq2[*T, error], err error)
 func Wrap(fn any) (*WrappedFunc, error) {
 	ctx := context.Background()
 
@@ -121,7 +148,7 @@ func Wrap(fn any) (*WrappedFunc, error) {
 
 	// resolve function parameter pointers to underlying type for use with
 	// reflect.New (which will return pointers).
-	var reqType reflect.Type
+	var reqType, resType, itemType reflect.Type
 	var hasResponseOutput bool
 
 	if inputCount == 2 {
@@ -136,10 +163,20 @@ func Wrap(fn any) (*WrappedFunc, error) {
 
 	if outputCount == 2 {
 		hasResponseOutput = true
+		resType = fnType.Out(0)
 
-		err := checkResponseType(ctx, fnType.Out(0))
-		if err != nil {
-			return nil, err
+		if typ, ok := streamItemType(resType); ok {
+			itemType = typ
+
+			err := checkStreamItemType(ctx, itemType)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			err := checkResponseType(ctx, resType)
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 
@@ -166,14 +203,27 @@ func Wrap(fn any) (*WrappedFunc, error) {
 				return cher.New(cher.BadRequest, nil, cher.New("missing_request_body", nil))
 			}
 
+			// strict decoding checks the body for unknown fields once decoded
+			var body bytes.Buffer
+			var src io.Reader = req.Body
+			if req.strictDecoding {
+				src = io.TeeReader(req.Body, &body)
+			}
+
 			reqVal := reflect.New(reqType)
-			err := json.NewDecoder(req.Body).Decode(reqVal.Interface())
+			err := json.NewDecoder(src).Decode(reqVal.Interface())
 			if errors.Is(err, io.EOF) {
 				return cher.New(cher.BadRequest, nil, cher.New("missing_request_body", nil))
 			} else if err != nil {
 				return merr.New(ctx, "request_body_decode_failed", nil, err)
 			}
 
+			if req.strictDecoding {
+				if err := unknownFieldsError(reqType, body.Bytes()); err != nil {
+					return err
+				}
+			}
+
 			inputs = []reflect.Value{ctxVal, reqVal}
 		}
 
@@ -185,6 +235,8 @@ func Wrap(fn any) (*WrappedFunc, error) {
 
 		if len(res) == 1 {
 			w.WriteHeader(http.StatusNoContent)
+		} else if itemType != nil {
+			return writeStream(w, req, res[0])
 		} else if len(res) == 2 {
 			enc := json.NewEncoder(w)
 			enc.SetEscapeHTML(false)
@@ -205,6 +257,8 @@ func Wrap(fn any) (*WrappedFunc, error) {
 		Handler:           handler,
 		HasRequestInput:   reqType != nil,
 		HasResponseOutput: hasResponseOutput,
+		ResponseType:      resType,
+		StreamItemType:    itemType,
 	}, nil
 }
 
@@ -235,6 +289,18 @@ func MustWrap(fn any) *WrappedFunc {
 type wrappedHandler struct {
 	v  string
 	fn HandlerFunc
+
+	// schema and wrapped describe the method for documentation purposes,
+	// wrapped is nil when the method was registered with RegisterFunc
+	schema  gojsonschema.JSONLoader
+	wrapped *WrappedFunc
+
+	opts registerOptions
+}
+
+// streams reports whether the method streams its response
+func (h *wrappedHandler) streams() bool {
+	return h.wrapped != nil && h.wrapped.StreamItemType != nil
 }
 
 // Server is an HTTP-compatible crpc handler.
@@ -245,6 +311,27 @@ type Server struct {
 	// AuthenticationMiddleware is configured, the server will panic.
 	AuthenticationMiddleware MiddlewareFunc
 
+	// MaxBodySize limits the size of request bodies in bytes, unless a method
+	// sets its own limit with WithMaxBodySize. Larger requests fail with
+	// cher.RequestTooLarge. Zero means no limit.
+	MaxBodySize int64
+
+	// AllowMissingAuthPolicies allows methods to be registered without
+	// WithAuthPolicy or Public. Otherwise Register panics for them, so a server
+	// can't start with a method whose authorization was forgotten. It exists
+	// for migrating servers whose methods predate auth policies, should not be
+	// set on new ones, and must be set before methods are registered.
+	AllowMissingAuthPolicies bool
+
+	// StrictDecoding rejects request bodies with fields the request type of a
+	// wrapped function doesn't have, rather than ignoring them. Methods can opt
+	// in individually with WithStrictDecoding.
+	StrictDecoding bool
+
+	// Messages attaches a user-facing message to errors, in the language of
+	// the Accept-Language request header, for codes it has a message for.
+	Messages *cher.Messages
+
 	// methods = version -> method -> HandlerFunc
 	registeredVersionMethods map[string]map[string]*wrappedHandler
 	registeredPreviewMethods map[string]*wrappedHandler
@@ -252,6 +339,15 @@ type Server struct {
 	resolvedMethods map[string]map[string]*wrappedHandler
 
 	mw []MiddlewareFunc
+
+	// deprecations = version -> method -> Deprecation, where an empty method
+	// applies to the whole version
+	deprecations map[string]map[string]Deprecation
+
+	codecs []Codec
+
+	batchMaxCalls    int
+	batchMaxParallel int
 }
 
 // NewServer returns a new RPC Server with an optional exception tracker.
@@ -293,8 +389,14 @@ func isValidMethod(method, version string) bool {
 // of the input argument, Register will panic. This function is not thread safe
 // and must be run in serial if called multiple times.
 func (s *Server) Register(method, version string, schema gojsonschema.JSONLoader, fn any, middleware ...MiddlewareFunc) {
+	s.RegisterWithOptions(method, version, schema, fn, middlewareOptions(middleware)...)
+}
+
+// RegisterWithOptions is Register with options such as WithTimeout or
+// WithAuthPolicy, which may be mixed with middleware.
+func (s *Server) RegisterWithOptions(method, version string, schema gojsonschema.JSONLoader, fn any, opts ...RegisterOption) {
 	if fn == nil {
-		s.RegisterFunc(method, version, schema, nil, middleware...)
+		s.RegisterFuncWithOptions(method, version, schema, nil, opts...)
 
 		return
 	}
@@ -310,13 +412,23 @@ func (s *Server) Register(method, version string, schema gojsonschema.JSONLoader
 		}
 	}
 
-	s.RegisterFunc(method, version, schema, &wrapped.Handler, middleware...)
+	s.register(method, version, schema, &wrapped.Handler, wrapped, opts)
 }
 
 // RegisterFunc associates a method name and version with a HandlerFunc,
-// and optional middleware. This function is not thread safe and must be run in
-// serial if called multiple times.
+// and optional middleware. This function is not thread safe and must be run
+// in serial if called multiple times.
 func (s *Server) RegisterFunc(method, version string, schema gojsonschema.JSONLoader, fn *HandlerFunc, middleware ...MiddlewareFunc) {
+	s.RegisterFuncWithOptions(method, version, schema, fn, middlewareOptions(middleware)...)
+}
+
+// RegisterFuncWithOptions is RegisterFunc with options such as WithTimeout or
+// WithAuthPolicy, which may be mixed with middleware.
+func (s *Server) RegisterFuncWithOptions(method, version string, schema gojsonschema.JSONLoader, fn *HandlerFunc, opts ...RegisterOption) {
+	s.register(method, version, schema, fn, nil, opts)
+}
+
+func (s *Server) register(method, version string, schema gojsonschema.JSONLoader, fn *HandlerFunc, wrapped *WrappedFunc, opts []RegisterOption) {
 	if s.registeredVersionMethods == nil {
 		s.registeredVersionMethods = make(map[string]map[string]*wrappedHandler)
 	}
@@ -346,6 +458,28 @@ func (s *Server) RegisterFunc(method, version string, schema gojsonschema.JSONLo
 	if fn == nil {
 		s.setRoute(version, method, nil)
 	} else {
+		o := buildRegisterOptions(opts)
+		middleware := o.middleware
+
+		if o.authPolicy == nil && !s.AllowMissingAuthPolicies {
+			panic(fmt.Sprintf("no auth policy configured for '%s' on version '%s'", method, version))
+		}
+
+		if o.authPolicy != nil && o.authPolicy.middleware != nil {
+			middleware = append([]MiddlewareFunc{o.authPolicy.middleware}, middleware...)
+		}
+
+		if o.responseSchema.compiled != nil {
+			switch {
+			case wrapped != nil && wrapped.ResponseType == nil:
+				panic("response schema validation configured, but handler doesn't return a response")
+			case wrapped != nil && wrapped.StreamItemType != nil:
+				panic("response schema validation is not supported for streamed responses")
+			}
+
+			middleware = append(middleware, validateResponse(o.responseSchema.compiled))
+		}
+
 		if schema != nil {
 			compiledSchema, err := gojsonschema.NewSchemaLoader().Compile(schema)
 			if err != nil {
@@ -357,6 +491,12 @@ func (s *Server) RegisterFunc(method, version string, schema gojsonschema.JSONLo
 			middleware = append([]MiddlewareFunc{s.AuthenticationMiddleware}, middleware...)
 		}
 
+		// the timeout covers all other method middleware, including
+		// authentication
+		if o.timeout > 0 {
+			middleware = append([]MiddlewareFunc{timeoutMiddleware(o.timeout)}, middleware...)
+		}
+
 		// This wraps the middleware funcs inside each one in reverse order
 		for i := range middleware {
 			p := middleware[len(middleware)-1-i](*fn)
@@ -368,7 +508,14 @@ func (s *Server) RegisterFunc(method, version string, schema gojsonschema.JSONLo
 			fn = &p
 		}
 
-		s.setRoute(version, method, &wrappedHandler{version, *fn})
+		s.setRoute(version, method, &wrappedHandler{
+			v:  version,
+			fn: *fn,
+
+			schema:  schema,
+			wrapped: wrapped,
+			opts:    *o,
+		})
 	}
 
 	s.buildRoutes()
@@ -487,14 +634,28 @@ func (s *Server) Serve(res http.ResponseWriter, req *Request) error {
 		return cher.New(cher.NotFound, cher.M{"version": req.Version})
 	}
 
+	if req.Method == BatchMethod && s.batchMaxCalls > 0 {
+		return s.serveBatch(res, req)
+	}
+
 	handler, ok := methodSet[req.Method]
 	if !ok || handler == nil {
 		return cher.New(cher.NotFound, cher.M{"method": req.Method, "version": req.Version})
 	}
 
+	req.ResolvedVersion = handler.v
+	req.strictDecoding = s.StrictDecoding || handler.opts.strictDecoding
+	req.streaming = handler.streams()
+
 	// append latest version to Infra-Endpoint-Status
 	appendInfraEndpointStatus(res, req.Version, handler.v)
 
+	if d, ok := s.deprecation(req.Version, req.Method); ok {
+		if err := applyDeprecation(req.Context(), res, req, d); err != nil {
+			return err
+		}
+	}
+
 	fn := handler.fn
 
 	return fn(res, req)
@@ -543,31 +704,80 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.URL.RawQuery != "" {
-		s.writeError(ctx, w, cher.New("unexpected_input", nil))
+		s.writeError(ctx, w, r, cher.New("unexpected_input", nil))
 		return
 	}
 
-	req := &Request{
-		Body: r.Body,
-
-		RemoteAddr:    r.RemoteAddr,
-		BrowserOrigin: r.Header.Get("Origin"),
+	timeout, err := requestTimeout(r)
+	if err != nil {
+		s.writeError(ctx, w, r, err)
+		return
 	}
 
-	ctx = setRequestContext(ctx, req)
-	r = r.WithContext(ctx)
-	req.originalRequest = r
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		r = r.WithContext(ctx)
+	}
 
-	var ok bool
-	req.Method, req.Version, ok = requestPath(r.URL.Path)
+	method, version, ok := requestPath(r.URL.Path)
 	if !ok {
-		s.writeError(ctx, w, cher.New(cher.NotFound, nil))
+		s.writeError(ctx, w, r, cher.New(cher.NotFound, nil))
 		return
 	}
 
-	s.writeError(ctx, w, s.Serve(w, req))
+	if limit := s.maxBodySize(version, method); limit > 0 && r.Body != nil {
+		r = r.WithContext(ctx)
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+
+	if codec := s.requestCodec(r); codec != nil {
+		body, err := decodeRequestBody(r, codec)
+		if err != nil {
+			s.writeError(ctx, w, r, err)
+			return
+		}
+
+		r = r.WithContext(ctx)
+		r.Body = body
+	}
+
+	if len(s.codecs) > 0 {
+		w.Header().Add("Vary", "Accept")
+
+		if codec := s.responseCodec(r); codec != nil {
+			cw := &codecResponseWriter{ResponseWriter: w, codec: codec}
+			defer cw.finish(r)
+
+			w = cw
+		}
+	}
+
+	req := newRequest(r)
+	req.Method, req.Version = method, version
+	ctx = req.Context()
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	s.writeError(ctx, w, r, coerceTimeout(ctx, s.Serve(w, req)))
+}
+
+// newRequest creates the Request for an HTTP request, making it available on
+// the request context
+func newRequest(r *http.Request) *Request {
+	req := &Request{
+		Body: r.Body,
+
+		RemoteAddr:    r.RemoteAddr,
+		BrowserOrigin: r.Header.Get("Origin"),
+	}
+
+	ctx := setRequestContext(r.Context(), req)
+	req.originalRequest = r.WithContext(ctx)
+
+	return req
 }
 
 // expRequestPath only matches HTTP Paths formed of /<version date>/<method name>
@@ -585,40 +795,69 @@ func requestPath(path string) (method, version string, ok bool) {
 	return method, version, ok
 }
 
-func (s *Server) writeError(ctx context.Context, w http.ResponseWriter, err error) {
+// writeError writes an error returned by a handler, as problem details if the
+// client prefers them
+func (s *Server) writeError(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) {
 	if err == nil {
 		return
 	}
 
-	var body cher.E
+	// the error has already been written as the final item of a stream
+	if _, ok := errors.AsType[streamWrittenError](err); ok {
+		return
+	}
+
+	body := s.localizeError(r, errorBody(err))
+
+	var out any = body
+	if cher.AcceptsProblem(r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", cher.ProblemContentType)
+		out = body.Problem()
+	}
 
-	if err, ok := errors.AsType[cher.E](err); ok {
-		body = err
-	} else if err, ok := errors.AsType[*json.SyntaxError](err); ok {
-		body = cher.New(
+	w.WriteHeader(body.StatusCode())
+
+	werr := json.NewEncoder(w).Encode(out)
+	if werr != nil {
+		mlog.Warn(ctx, merr.New(ctx, "crpc_write_error_failed", nil, werr))
+	}
+}
+
+// localizeError attaches a message from Messages to an error, if the server
+// has any
+func (s *Server) localizeError(r *http.Request, cerr cher.E) cher.E {
+	if s.Messages == nil {
+		return cerr
+	}
+
+	return s.Messages.Localize(cerr, r.Header.Get("Accept-Language"))
+}
+
+// errorBody converts an error returned by a handler into the cher error
+// returned to the client
+func errorBody(err error) cher.E {
+	if cerr, ok := errors.AsType[cher.E](err); ok {
+		return cerr
+	} else if mbErr, ok := errors.AsType[*http.MaxBytesError](err); ok {
+		return requestTooLarge(mbErr.Limit)
+	} else if synErr, ok := errors.AsType[*json.SyntaxError](err); ok {
+		return cher.New(
 			"invalid_json",
 			cher.M{
-				"error":  err.Error(),
-				"offset": err.Offset,
+				"error":  synErr.Error(),
+				"offset": synErr.Offset,
 			},
 		)
-	} else if err, ok := errors.AsType[*json.UnmarshalTypeError](err); ok {
-		body = cher.New(
+	} else if typeErr, ok := errors.AsType[*json.UnmarshalTypeError](err); ok {
+		return cher.New(
 			"invalid_json",
 			cher.M{
-				"expected": err.Type.Kind().String(),
-				"actual":   err.Value,
-				"name":     err.Field,
+				"expected": typeErr.Type.Kind().String(),
+				"actual":   typeErr.Value,
+				"name":     typeErr.Field,
 			},
 		)
-	} else {
-		body = cher.New(cher.Unknown, nil)
 	}
 
-	w.WriteHeader(body.StatusCode())
-
-	werr := json.NewEncoder(w).Encode(body)
-	if werr != nil {
-		mlog.Warn(ctx, merr.New(ctx, "crpc_write_error_failed", nil, werr))
-	}
+	return cher.New(cher.Unknown, nil)
 }
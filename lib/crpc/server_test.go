@@ -2,12 +2,18 @@ package crpc
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/matryer/is"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
 	"github.com/wearemojo/mojo-public-go/lib/merr"
+	"github.com/wearemojo/mojo-public-go/lib/redact"
 	"github.com/xeipuuv/gojsonschema"
 )
 
@@ -326,6 +332,7 @@ func TestPanicIfMethodDeclaredTwice(t *testing.T) {
 	}()
 
 	zs := NewServer(UnsafeNoAuthentication)
+	zs.AllowMissingAuthPolicies = true
 
 	zs.Register("foo", "2019-01-01", nil, func(context.Context) error { return nil })
 
@@ -335,6 +342,7 @@ func TestPanicIfMethodDeclaredTwice(t *testing.T) {
 func TestMiddlewareIsLoadedInOrder(t *testing.T) {
 	ctx := t.Context()
 	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
 
 	rpc.Register("foo", "preview", nil, makeRPCCall("called foo!"))
 	rpc.Use(addHeaderMiddleware("X-Is-Test", "win!"))
@@ -362,6 +370,7 @@ func TestMiddlewareIsLoadedInOrder(t *testing.T) {
 func TestMiddlewareRunsGlobalInOrderAndRequestSpecific(t *testing.T) {
 	ctx := t.Context()
 	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
 
 	rpc.Use(addHeaderMiddleware("X-Present-On-Both", "win!"))
 	rpc.Register("foo", "preview", nil, makeRPCCall("called foo!"))
@@ -423,6 +432,29 @@ func makeRPCCall(messageToReturn string) func(context.Context) (*testResponse, e
 	}
 }
 
+func TestRegisterAcceptsMiddlewareSlice(t *testing.T) {
+	is := is.New(t)
+
+	middleware := []MiddlewareFunc{
+		addHeaderMiddleware("X-First", "1"),
+		addHeaderMiddleware("X-Second", "2"),
+	}
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("foo", "preview", nil, makeRPCCall("called foo!"), middleware...)
+	rpc.RegisterWithOptions("bar", "preview", nil, makeRPCCall("called bar!"), middleware[0], WithTimeout(time.Second))
+
+	for _, method := range []string{"foo", "bar"} {
+		rec := httptest.NewRecorder()
+		r, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, "/preview/"+method, nil)
+
+		rpc.ServeHTTP(rec, r)
+
+		is.Equal(rec.Header().Get("X-First"), "1")
+	}
+}
+
 func TestSchemasAreCompiled(t *testing.T) {
 	brokenSchema := gojsonschema.NewStringLoader(`{
 		"type": "object",
@@ -442,6 +474,7 @@ func TestSchemasAreCompiled(t *testing.T) {
 	}
 
 	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
 
 	rpc.Register("should_pass", "2019-01-01", validSchema, handler)
 
@@ -454,6 +487,105 @@ func TestSchemasAreCompiled(t *testing.T) {
 	rpc.Register("should_crash", "2019-01-01", brokenSchema, handler)
 }
 
+func TestErrorsAreWrittenAsProblemsWhenAccepted(t *testing.T) {
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("fail", "2019-01-01", nil, func(context.Context) error {
+		return cher.New(cher.NotFound, cher.M{"message": "no such thing"})
+	})
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"Native", "application/json", "application/json; charset=utf-8", `{"code":"not_found","meta":{"message":"no such thing"}}`},
+		{"Problem", "application/problem+json", cher.ProblemContentType, `{"type":"urn:cher:not_found","title":"The requested resource doesn't exist","status":404,"detail":"no such thing","code":"not_found","meta":{"message":"no such thing"}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/2019-01-01/fail", nil)
+			r.Header.Set("Accept", test.accept)
+
+			rpc.ServeHTTP(rec, r)
+
+			is.Equal(rec.Code, http.StatusNotFound)
+			is.Equal(rec.Header().Get("Content-Type"), test.contentType)
+			is.Equal(strings.TrimSpace(rec.Body.String()), test.body)
+		})
+	}
+}
+
+func TestErrorsAreLocalized(t *testing.T) {
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Messages = cher.MustLoadMessages(fstest.MapFS{
+		"en.json": {Data: []byte(`{"not_found": "We couldn't find {thing}"}`)},
+		"es.json": {Data: []byte(`{"not_found": "No encontramos {thing}"}`)},
+	}, "en")
+	rpc.Register("fail", "2019-01-01", nil, func(context.Context) error {
+		return cher.New(cher.NotFound, cher.M{"thing": "it"})
+	})
+
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		message        string
+	}{
+		{"Default", "", "We couldn't find it"},
+		{"Accepted", "es-ES, en;q=0.5", "No encontramos it"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/2019-01-01/fail", nil)
+			r.Header.Set("Accept-Language", test.acceptLanguage)
+
+			rpc.ServeHTTP(rec, r)
+
+			var body cher.E
+			is.NoErr(json.Unmarshal(rec.Body.Bytes(), &body))
+			is.Equal(body.Code, cher.NotFound)
+			is.Equal(body.Message, test.message)
+		})
+	}
+}
+
+func TestSensitiveErrorMetaIsRedacted(t *testing.T) {
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("fail", "2019-01-01", nil, func(context.Context) error {
+		return cher.New(cher.BadRequest, cher.M{
+			"email": redact.Wrap("user@example.com"),
+			"token": "secret-token",
+		})
+	})
+
+	for _, accept := range []string{"application/json", cher.ProblemContentType} {
+		t.Run(accept, func(t *testing.T) {
+			is := is.New(t)
+
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/2019-01-01/fail", nil)
+			r.Header.Set("Accept", accept)
+
+			rpc.ServeHTTP(rec, r)
+
+			is.Equal(rec.Code, http.StatusBadRequest)
+			is.True(!strings.Contains(rec.Body.String(), "user@example.com")) // wrapped values are redacted
+			is.True(!strings.Contains(rec.Body.String(), "secret-token"))     // policy keys are redacted
+		})
+	}
+}
+
 func UnsafeNoAuthentication(next HandlerFunc) HandlerFunc {
 	return func(res http.ResponseWriter, req *Request) error {
 		return next(res, req)
@@ -0,0 +1,422 @@
+package crpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Snapshot records the methods of every dated version of a server along with
+// their request and response schemas, so changes to versions which clients
+// already depend on can be detected with DiffSnapshots. Snapshots are JSON
+// serializable, to be kept alongside the code.
+type Snapshot struct {
+	// Versions maps each dated version to the methods it resolves
+	Versions map[string]map[string]SnapshotMethod `json:"versions"`
+}
+
+// SnapshotMethod is the contract of a method as of a snapshot. Request is nil
+// for methods without a request body, and Response is nil for methods without
+// a response body, or whose response can't be described.
+type SnapshotMethod struct {
+	ResolvedVersion string         `json:"resolved_version"`
+	Request         map[string]any `json:"request,omitempty"`
+	Response        map[string]any `json:"response,omitempty"`
+	HasResponse     bool           `json:"has_response"`
+}
+
+// Snapshot returns the contract of every dated version of the server. The
+// preview and latest versions are excluded, as they make no promises.
+func (s *Server) Snapshot() *Snapshot {
+	snap := &Snapshot{Versions: map[string]map[string]SnapshotMethod{}}
+
+	for version, methodSet := range s.resolvedMethods {
+		if version == VersionPreview || version == VersionLatest {
+			continue
+		}
+
+		methods := map[string]SnapshotMethod{}
+
+		for method, handler := range methodSet {
+			if handler == nil {
+				continue
+			}
+
+			methods[method] = handler.snapshotMethod()
+		}
+
+		snap.Versions[version] = methods
+	}
+
+	return snap
+}
+
+func (h *wrappedHandler) snapshotMethod() SnapshotMethod {
+	sm := SnapshotMethod{
+		ResolvedVersion: h.v,
+		HasResponse:     h.wrapped == nil || h.wrapped.ResponseType != nil,
+	}
+
+	if h.schema != nil {
+		if schema, err := h.schema.LoadJSON(); err == nil {
+			sm.Request = normalizeSchema(schema)
+		}
+	}
+
+	switch {
+	case h.opts.responseSchema.loader != nil:
+		if schema, err := h.opts.responseSchema.loader.LoadJSON(); err == nil {
+			sm.Response = normalizeSchema(schema)
+		}
+
+	case h.wrapped == nil || h.wrapped.ResponseType == nil:
+		// nothing is known about the response, or there isn't one
+
+	case h.wrapped.StreamItemType != nil:
+		sm.Response = normalizeSchema(reflectSchema(h.wrapped.StreamItemType, map[reflect.Type]bool{}))
+
+	default:
+		sm.Response = normalizeSchema(reflectSchema(h.wrapped.ResponseType, map[reflect.Type]bool{}))
+	}
+
+	return sm
+}
+
+// normalizeSchema converts a schema to the types produced by decoding JSON,
+// so loaded and reflected schemas are compared alike
+func normalizeSchema(schema any) map[string]any {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil
+	}
+
+	var normalized map[string]any
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil
+	}
+
+	return normalized
+}
+
+// BreakingChangeKind is the kind of a BreakingChange.
+type BreakingChangeKind string
+
+const (
+	// BreakingMethodRemoved is a method which a version no longer has
+	BreakingMethodRemoved BreakingChangeKind = "method_removed"
+
+	// BreakingRequestBodyAdded is a method which now requires a request body
+	BreakingRequestBodyAdded BreakingChangeKind = "request_body_added"
+
+	// BreakingResponseRemoved is a method which no longer returns a response
+	BreakingResponseRemoved BreakingChangeKind = "response_removed"
+
+	// BreakingFieldRequired is a request field which is now required
+	BreakingFieldRequired BreakingChangeKind = "field_required"
+
+	// BreakingFieldOptional is a response field which may now be absent
+	BreakingFieldOptional BreakingChangeKind = "field_optional"
+
+	// BreakingPropertyRemoved is a response property which was removed, or a
+	// request property which is now rejected
+	BreakingPropertyRemoved BreakingChangeKind = "property_removed"
+
+	// BreakingTypeChanged is a request type which accepts fewer values, or a
+	// response type which may produce values it didn't before
+	BreakingTypeChanged BreakingChangeKind = "type_changed"
+
+	// BreakingEnumChanged is a request enum which lost values, or a response
+	// enum which gained them
+	BreakingEnumChanged BreakingChangeKind = "enum_changed"
+)
+
+// BreakingChange is a change to a dated version which can break its clients.
+type BreakingChange struct {
+	Version string             `json:"version"`
+	Method  string             `json:"method"`
+	Kind    BreakingChangeKind `json:"kind"`
+
+	// Path locates the change within the request or response, e.g.
+	// `request.user.name`
+	Path string `json:"path,omitempty"`
+
+	Detail string `json:"detail,omitempty"`
+}
+
+func (c BreakingChange) String() string {
+	msg := fmt.Sprintf("%s/%s: %s", c.Version, c.Method, c.Kind)
+	if c.Path != "" {
+		msg += " at " + c.Path
+	}
+	if c.Detail != "" {
+		msg += " (" + c.Detail + ")"
+	}
+
+	return msg
+}
+
+// DiffSnapshots reports the changes from before to after which can break
+// clients of the versions in before. Versions only in after, and changes which
+// clients can't notice, such as new optional request fields or new response
+// fields, are not reported.
+func DiffSnapshots(before, after *Snapshot) []BreakingChange {
+	changes := []BreakingChange{}
+
+	for version, beforeMethods := range before.Versions {
+		afterMethods, ok := after.Versions[version]
+		if !ok {
+			afterMethods = map[string]SnapshotMethod{}
+		}
+
+		for method, beforeMethod := range beforeMethods {
+			d := &schemaDiff{version: version, method: method}
+
+			afterMethod, ok := afterMethods[method]
+			if !ok {
+				d.add(BreakingMethodRemoved, "", "")
+			} else {
+				d.diffMethod(beforeMethod, afterMethod)
+			}
+
+			changes = append(changes, d.changes...)
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b BreakingChange) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	return changes
+}
+
+type schemaDiff struct {
+	version, method string
+	changes         []BreakingChange
+}
+
+func (d *schemaDiff) add(kind BreakingChangeKind, path, detail string) {
+	d.changes = append(d.changes, BreakingChange{
+		Version: d.version,
+		Method:  d.method,
+		Kind:    kind,
+		Path:    path,
+		Detail:  detail,
+	})
+}
+
+func (d *schemaDiff) diffMethod(before, after SnapshotMethod) {
+	switch {
+	case before.Request == nil && after.Request != nil:
+		d.add(BreakingRequestBodyAdded, "", "")
+	case before.Request != nil && after.Request != nil:
+		d.diffRequest("request", before.Request, after.Request)
+	}
+
+	switch {
+	case before.HasResponse && !after.HasResponse:
+		d.add(BreakingResponseRemoved, "", "")
+	case before.Response != nil && after.Response != nil:
+		d.diffResponse("response", before.Response, after.Response)
+	}
+}
+
+// diffRequest compares request schemas, which must accept everything they
+// accepted before
+func (d *schemaDiff) diffRequest(path string, before, after map[string]any) {
+	if beforeTypes, afterTypes := schemaTypes(before), schemaTypes(after); !typesCover(afterTypes, beforeTypes) {
+		d.add(BreakingTypeChanged, path, describeTypeChange(beforeTypes, afterTypes))
+		return
+	}
+
+	if beforeEnum, afterEnum := schemaEnum(before), schemaEnum(after); afterEnum != nil {
+		if beforeEnum == nil {
+			d.add(BreakingEnumChanged, path, "now restricted to "+describeEnum(afterEnum))
+		} else if missing := enumMissing(afterEnum, beforeEnum); len(missing) > 0 {
+			d.add(BreakingEnumChanged, path, "no longer accepts "+describeEnum(missing))
+		}
+	}
+
+	beforeRequired, afterRequired := schemaRequired(before), schemaRequired(after)
+	for _, name := range afterRequired {
+		if !slices.Contains(beforeRequired, name) {
+			d.add(BreakingFieldRequired, path+"."+name, "")
+		}
+	}
+
+	beforeProps, afterProps := schemaProperties(before), schemaProperties(after)
+	for _, name := range sortedKeys(beforeProps) {
+		afterProp, ok := afterProps[name]
+		if !ok {
+			if after["additionalProperties"] == false {
+				d.add(BreakingPropertyRemoved, path+"."+name, "additional properties are not allowed")
+			}
+
+			continue
+		}
+
+		d.diffRequest(path+"."+name, schemaObject(beforeProps[name]), schemaObject(afterProp))
+	}
+
+	if beforeItems, afterItems := schemaObject(before["items"]), schemaObject(after["items"]); beforeItems != nil && afterItems != nil {
+		d.diffRequest(path+"[]", beforeItems, afterItems)
+	}
+}
+
+// diffResponse compares response schemas, which must only produce what they
+// could produce before
+func (d *schemaDiff) diffResponse(path string, before, after map[string]any) {
+	if beforeTypes, afterTypes := schemaTypes(before), schemaTypes(after); !typesCover(beforeTypes, afterTypes) {
+		d.add(BreakingTypeChanged, path, describeTypeChange(beforeTypes, afterTypes))
+		return
+	}
+
+	if beforeEnum, afterEnum := schemaEnum(before), schemaEnum(after); beforeEnum != nil {
+		if afterEnum == nil {
+			d.add(BreakingEnumChanged, path, "no longer restricted")
+		} else if added := enumMissing(beforeEnum, afterEnum); len(added) > 0 {
+			d.add(BreakingEnumChanged, path, "may now be "+describeEnum(added))
+		}
+	}
+
+	beforeProps, afterProps := schemaProperties(before), schemaProperties(after)
+
+	beforeRequired, afterRequired := schemaRequired(before), schemaRequired(after)
+	for _, name := range beforeRequired {
+		// removed properties are reported as such below
+		if _, ok := afterProps[name]; ok && !slices.Contains(afterRequired, name) {
+			d.add(BreakingFieldOptional, path+"."+name, "")
+		}
+	}
+
+	for _, name := range sortedKeys(beforeProps) {
+		afterProp, ok := afterProps[name]
+		if !ok {
+			d.add(BreakingPropertyRemoved, path+"."+name, "")
+			continue
+		}
+
+		d.diffResponse(path+"."+name, schemaObject(beforeProps[name]), schemaObject(afterProp))
+	}
+
+	if beforeItems, afterItems := schemaObject(before["items"]), schemaObject(after["items"]); beforeItems != nil && afterItems != nil {
+		d.diffResponse(path+"[]", beforeItems, afterItems)
+	}
+}
+
+func schemaObject(v any) map[string]any {
+	obj, _ := v.(map[string]any)
+	return obj
+}
+
+func schemaProperties(schema map[string]any) map[string]any {
+	props, _ := schema["properties"].(map[string]any)
+	return props
+}
+
+func schemaRequired(schema map[string]any) []string {
+	list, _ := schema["required"].([]any)
+
+	required := make([]string, 0, len(list))
+	for _, name := range list {
+		if name, ok := name.(string); ok {
+			required = append(required, name)
+		}
+	}
+
+	return required
+}
+
+// schemaTypes returns the JSON types a schema allows, or nil if it allows any
+func schemaTypes(schema map[string]any) []string {
+	switch typ := schema["type"].(type) {
+	case string:
+		return []string{typ}
+
+	case []any:
+		types := []string{}
+		for _, t := range typ {
+			if t, ok := t.(string); ok {
+				types = append(types, t)
+			}
+		}
+
+		return types
+
+	default:
+		return nil
+	}
+}
+
+// typesCover reports whether every value of the inner types is allowed by the
+// outer types, where nil allows any value
+func typesCover(outer, inner []string) bool {
+	if outer == nil {
+		return true
+	} else if inner == nil {
+		return false
+	}
+
+	for _, t := range inner {
+		if slices.Contains(outer, t) || (t == "integer" && slices.Contains(outer, "number")) {
+			continue
+		}
+
+		return false
+	}
+
+	return true
+}
+
+func describeTypeChange(before, after []string) string {
+	describe := func(types []string) string {
+		if types == nil {
+			return "any"
+		}
+
+		return strings.Join(types, "|")
+	}
+
+	return describe(before) + " to " + describe(after)
+}
+
+func schemaEnum(schema map[string]any) []any {
+	enum, _ := schema["enum"].([]any)
+	return enum
+}
+
+// enumMissing returns the values of inner which outer doesn't have
+func enumMissing(outer, inner []any) []any {
+	missing := []any{}
+
+	for _, value := range inner {
+		if !slices.ContainsFunc(outer, func(v any) bool { return reflect.DeepEqual(v, value) }) {
+			missing = append(missing, value)
+		}
+	}
+
+	return missing
+}
+
+func describeEnum(values []any) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		data, _ := json.Marshal(value)
+		parts[i] = string(data)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,116 @@
+package crpc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+func snapshotTestServer(requestSchema string, register func(rpc *Server, schema gojsonschema.JSONLoader)) *Server {
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	register(rpc, gojsonschema.NewStringLoader(requestSchema))
+
+	return rpc
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	type user struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+
+	type userV2 struct {
+		Name string `json:"name"`
+	}
+
+	getUser := func(context.Context, *struct{}) (*user, error) { return nil, nil }
+	getUserV2 := func(context.Context, *struct{}) (*userV2, error) { return nil, nil }
+	noop := func(context.Context, *struct{}) error { return nil }
+
+	before := `{
+		"type": "object",
+		"additionalProperties": false,
+		"properties": {
+			"id": {"type": "string"},
+			"limit": {"type": "number"},
+			"sort": {"type": "string", "enum": ["asc", "desc"]}
+		},
+		"required": ["id"]
+	}`
+
+	tests := []struct {
+		name     string
+		after    string
+		register func(rpc *Server, schema gojsonschema.JSONLoader)
+		changes  []string
+	}{
+		{
+			name:  "Compatible",
+			after: `{"type": "object", "properties": {"id": {"type": "string"}, "limit": {"type": "number"}, "sort": {"type": "string", "enum": ["asc", "desc", "random"]}, "cursor": {"type": "string"}}, "required": ["id"]}`,
+			register: func(rpc *Server, schema gojsonschema.JSONLoader) {
+				rpc.Register("get_user", "2019-01-01", schema, getUser)
+				rpc.Register("get_user", "2020-01-01", schema, getUserV2)
+				rpc.Register("ping", "2019-01-01", schema, noop)
+			},
+			changes: []string{},
+		},
+		{
+			name:  "Breaking",
+			after: `{"type": "object", "additionalProperties": false, "properties": {"id": {"type": "string"}, "limit": {"type": "integer"}, "sort": {"type": "string", "enum": ["asc"]}}, "required": ["id", "limit"]}`,
+			register: func(rpc *Server, schema gojsonschema.JSONLoader) {
+				rpc.Register("get_user", "2019-01-01", schema, getUserV2)
+			},
+			changes: []string{
+				"2019-01-01/get_user: enum_changed at request.sort (no longer accepts \"desc\")",
+				"2019-01-01/get_user: field_required at request.limit",
+				"2019-01-01/get_user: property_removed at response.email",
+				"2019-01-01/get_user: type_changed at request.limit (number to integer)",
+				"2019-01-01/ping: method_removed",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+
+			beforeServer := snapshotTestServer(before, func(rpc *Server, schema gojsonschema.JSONLoader) {
+				rpc.Register("get_user", "2019-01-01", schema, getUser)
+				rpc.Register("ping", "2019-01-01", schema, noop)
+			})
+
+			afterServer := snapshotTestServer(test.after, test.register)
+
+			changes := []string{}
+			for _, change := range DiffSnapshots(beforeServer.Snapshot(), afterServer.Snapshot()) {
+				changes = append(changes, change.String())
+			}
+
+			is.Equal(changes, test.changes)
+		})
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	is := is.New(t)
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("ping", "2019-01-01", nil, func(context.Context) error { return nil })
+	rpc.Register("ping", "preview", nil, func(context.Context) error { return nil })
+
+	snap := rpc.Snapshot()
+	is.Equal(len(snap.Versions), 1)                                  // preview and latest are excluded
+	is.Equal(snap.Versions["2019-01-01"]["ping"].HasResponse, false) // ping has no response
+
+	data, err := json.Marshal(snap)
+	is.NoErr(err)
+
+	var loaded Snapshot
+	is.NoErr(json.Unmarshal(data, &loaded))
+	is.Equal(len(DiffSnapshots(&loaded, snap)), 0)
+}
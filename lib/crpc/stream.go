@@ -0,0 +1,219 @@
+package crpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/merr"
+)
+
+const (
+	// ContentTypeNDJSON is used for streamed responses unless the client
+	// accepts ContentTypeEventStream. Each line is a JSON encoded StreamLine.
+	ContentTypeNDJSON = "application/x-ndjson"
+
+	// ContentTypeEventStream is used for streamed responses when accepted by
+	// the client. Items are sent as `item` events, errors as `error` events, and
+	// the end of a complete stream as a `done` event.
+	ContentTypeEventStream = "text/event-stream"
+)
+
+// StreamLine is a single line of an NDJSON streamed response. Exactly one of
+// Item, Error or Done is set. Every stream ends with a line with either Error
+// or Done set, so a stream ending without one was cut short.
+type StreamLine struct {
+	Item  json.RawMessage `json:"item,omitempty"`
+	Error *cher.E         `json:"error,omitempty"`
+	Done  bool            `json:"done,omitempty"`
+}
+
+// streamWrittenError is returned when a stream fails after the response has
+// started, once the error has been written as the final item of the stream
+type streamWrittenError struct {
+	cause error
+}
+
+func (e streamWrittenError) Error() string {
+	return "stream failed: " + e.cause.Error()
+}
+
+func (e streamWrittenError) Unwrap() error {
+	return e.cause
+}
+
+// streamItemType returns T when typ is an iter.Seq2[T, error]
+func streamItemType(typ reflect.Type) (reflect.Type, bool) {
+	if typ.Kind() != reflect.Func || typ.NumIn() != 1 || typ.NumOut() != 0 {
+		return nil, false
+	}
+
+	yield := typ.In(0)
+	if yield.Kind() != reflect.Func || yield.NumIn() != 2 || yield.NumOut() != 1 {
+		return nil, false
+	}
+
+	if yield.In(1) != errorType || yield.Out(0).Kind() != reflect.Bool {
+		return nil, false
+	}
+
+	return yield.In(0), true
+}
+
+func checkStreamItemType(ctx context.Context, typ reflect.Type) error {
+	switch {
+	case
+		typ.Kind() == reflect.Pointer && typ.Elem().Kind() == reflect.Struct, // *SomeStruct
+		typ.Kind() == reflect.Map && typ.Key().Kind() == reflect.String:      // map[string]any
+		return nil
+	default:
+		return merr.New(ctx, "stream_item_type_invalid", merr.M{"type": typ.Kind()})
+	}
+}
+
+// prefersEventStream reports whether an Accept header prefers server-sent
+// events to NDJSON, which is used otherwise
+func prefersEventStream(accept string) bool {
+	for _, mediaType := range acceptedMediaTypes(accept) {
+		switch mediaType {
+		case ContentTypeEventStream:
+			return true
+		case ContentTypeNDJSON:
+			return false
+		}
+	}
+
+	return false
+}
+
+// writeStream writes every item yielded by seq as it is yielded, flushing
+// after each one. Errors yielded before the first item are returned as normal,
+// as the response has not started yet.
+func writeStream(w http.ResponseWriter, req *Request, seq reflect.Value) error {
+	if seq.IsNil() {
+		seq = reflect.MakeFunc(seq.Type(), func([]reflect.Value) []reflect.Value { return nil })
+	}
+
+	sse := prefersEventStream(req.originalRequest.Header.Get("Accept"))
+	rc := http.NewResponseController(w)
+
+	var started bool
+	var streamErr error
+
+	start := func() {
+		if started {
+			return
+		}
+
+		started = true
+
+		if sse {
+			w.Header().Set("Content-Type", ContentTypeEventStream)
+			w.Header().Set("Cache-Control", "no-cache")
+		} else {
+			w.Header().Set("Content-Type", ContentTypeNDJSON)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+
+	write := func(event string, line StreamLine) error {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+
+		var err error
+		switch {
+		case !sse:
+			err = enc.Encode(line)
+		case line.Error != nil:
+			err = enc.Encode(line.Error)
+		case line.Done:
+			err = enc.Encode(struct{}{})
+		default:
+			_, err = buf.Write(append(line.Item, '\n'))
+		}
+		if err != nil {
+			return err
+		}
+
+		if sse {
+			_, err = w.Write([]byte("event: " + event + "\ndata: "))
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = w.Write(buf.Bytes())
+		if err != nil {
+			return err
+		}
+
+		if sse {
+			_, err = w.Write([]byte("\n"))
+			if err != nil {
+				return err
+			}
+		}
+
+		// not every ResponseWriter supports flushing, which only delays delivery
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+
+		return nil
+	}
+
+	yield := reflect.MakeFunc(seq.Type().In(0), func(args []reflect.Value) []reflect.Value {
+		if errVal := args[1]; !errVal.IsNil() {
+			streamErr = errVal.Interface().(error) //nolint:forcetypeassert // we checked the type when wrapping
+			return []reflect.Value{reflect.ValueOf(false)}
+		}
+
+		item, err := json.Marshal(args[0].Interface())
+		if err != nil {
+			streamErr = err
+			return []reflect.Value{reflect.ValueOf(false)}
+		}
+
+		start()
+
+		if err := write("item", StreamLine{Item: item}); err != nil {
+			streamErr = err
+			return []reflect.Value{reflect.ValueOf(false)}
+		}
+
+		return []reflect.Value{reflect.ValueOf(true)}
+	})
+
+	seq.Call([]reflect.Value{yield})
+
+	if streamErr == nil {
+		start()
+		return write("done", StreamLine{Done: true})
+	}
+
+	if !started {
+		return streamErr
+	}
+
+	if strings.Contains(streamErr.Error(), "broken pipe") {
+		return nil
+	}
+
+	cerr, ok := errors.AsType[cher.E](streamErr)
+	if !ok {
+		cerr = cher.New(cher.Unknown, nil)
+	}
+
+	if err := write("error", StreamLine{Error: &cerr}); err != nil {
+		return err
+	}
+
+	return streamWrittenError{streamErr}
+}
@@ -0,0 +1,221 @@
+package crpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/sirupsen/logrus"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/clog"
+)
+
+type streamTestItem struct {
+	N int `json:"n"`
+}
+
+func streamTestServer(failAfter int, middleware ...MiddlewareFunc) *Server {
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("count", "2019-01-01", nil, func(context.Context) (iter.Seq2[*streamTestItem, error], error) {
+		return func(yield func(*streamTestItem, error) bool) {
+			for n := range 3 {
+				if n == failAfter {
+					yield(nil, cher.New("count_failed", nil))
+					return
+				}
+
+				if !yield(&streamTestItem{N: n}, nil) {
+					return
+				}
+			}
+		}, nil
+	}, middleware...)
+
+	return rpc
+}
+
+func TestStream(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	srv := httptest.NewServer(streamTestServer(-1))
+	defer srv.Close()
+
+	client := NewClient(ctx, srv.URL, nil)
+
+	var items []int
+	for item, err := range Stream[streamTestItem](ctx, client, "count", "2019-01-01", nil) {
+		is.NoErr(err)
+		items = append(items, item.N)
+	}
+
+	is.Equal(items, []int{0, 1, 2})
+}
+
+func TestStreamNDJSON(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	rec := httptest.NewRecorder()
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/2019-01-01/count", nil)
+
+	streamTestServer(-1).ServeHTTP(rec, r)
+
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Header().Get("Content-Type"), ContentTypeNDJSON)
+	is.Equal(rec.Body.String(), `{"item":{"n":0}}`+"\n"+
+		`{"item":{"n":1}}`+"\n"+
+		`{"item":{"n":2}}`+"\n"+
+		`{"done":true}`+"\n")
+}
+
+func TestStreamCutShort(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeNDJSON)
+		_, _ = w.Write([]byte(`{"item":{"n":0}}` + "\n"))
+	}))
+	defer srv.Close()
+
+	client := NewClient(ctx, srv.URL, nil)
+
+	var items []int
+	var errs []error
+	for item, err := range Stream[streamTestItem](ctx, client, "count", "2019-01-01", nil) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		items = append(items, item.N)
+	}
+
+	is.Equal(items, []int{0})
+	is.Equal(len(errs), 1)
+
+	transportErr, ok := errs[0].(ClientTransportError) //nolint:errorlint // required for test
+	is.True(ok)
+	is.True(errors.Is(transportErr.Cause(), io.ErrUnexpectedEOF))
+}
+
+func TestStreamUnsupported(t *testing.T) {
+	rpc := streamTestServer(-1, Idempotency(NewMemoryIdempotencyStore(), time.Hour))
+	rpc.EnableBatch(10, 1)
+
+	t.Run("Idempotency", func(t *testing.T) {
+		is := is.New(t)
+
+		rec := httptest.NewRecorder()
+		r, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, "/2019-01-01/count", nil)
+		r.Header.Set(IdempotencyKeyHeader, "abc")
+
+		rpc.ServeHTTP(rec, r)
+
+		is.Equal(rec.Code, http.StatusBadRequest)
+		is.True(strings.Contains(rec.Body.String(), "idempotency_stream_unsupported"))
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		is := is.New(t)
+
+		rec := httptest.NewRecorder()
+		r, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, "/2019-01-01/"+BatchMethod, strings.NewReader(`{"calls":[{"method":"count"}]}`))
+		r = r.WithContext(clog.Set(r.Context(), logrus.NewEntry(logrus.New())))
+
+		rpc.ServeHTTP(rec, r)
+
+		is.Equal(rec.Code, http.StatusOK)
+		is.True(strings.Contains(rec.Body.String(), "batch_stream_unsupported"))
+	})
+}
+
+func TestStreamError(t *testing.T) {
+	t.Run("BeforeFirstItem", func(t *testing.T) {
+		is := is.New(t)
+		ctx := t.Context()
+
+		rec := httptest.NewRecorder()
+		r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/2019-01-01/count", nil)
+
+		streamTestServer(0).ServeHTTP(rec, r)
+
+		is.Equal(rec.Code, http.StatusBadRequest)
+		is.Equal(strings.TrimSpace(rec.Body.String()), `{"code":"count_failed"}`)
+	})
+
+	t.Run("AfterFirstItem", func(t *testing.T) {
+		is := is.New(t)
+		ctx := t.Context()
+
+		srv := httptest.NewServer(streamTestServer(2))
+		defer srv.Close()
+
+		client := NewClient(ctx, srv.URL, nil)
+
+		var items []int
+		var errs []error
+		for item, err := range Stream[streamTestItem](ctx, client, "count", "2019-01-01", nil) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			items = append(items, item.N)
+		}
+
+		is.Equal(items, []int{0, 1})
+		is.Equal(len(errs), 1)
+
+		cerr, ok := errs[0].(cher.E) //nolint:errorlint // required for test
+		is.True(ok)
+		is.Equal(cerr.Code, "count_failed")
+	})
+}
+
+func TestStreamEventStream(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	rec := httptest.NewRecorder()
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/2019-01-01/count", nil)
+	r.Header.Set("Accept", ContentTypeEventStream)
+
+	streamTestServer(2).ServeHTTP(rec, r)
+
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Header().Get("Content-Type"), ContentTypeEventStream)
+	is.Equal(rec.Body.String(), "event: item\ndata: {\"n\":0}\n\n"+
+		"event: item\ndata: {\"n\":1}\n\n"+
+		"event: error\ndata: {\"code\":\"count_failed\"}\n\n")
+}
+
+func TestStreamAcceptQuality(t *testing.T) {
+	for accept, contentType := range map[string]string{
+		ContentTypeEventStream:                                  ContentTypeEventStream,
+		ContentTypeEventStream + ";q=0, " + ContentTypeNDJSON:   ContentTypeNDJSON,
+		ContentTypeNDJSON + ";q=0.5, " + ContentTypeEventStream: ContentTypeEventStream,
+		ContentTypeNDJSON + ", " + ContentTypeEventStream:       ContentTypeNDJSON,
+	} {
+		t.Run(accept, func(t *testing.T) {
+			is := is.New(t)
+
+			rec := httptest.NewRecorder()
+			r, _ := http.NewRequestWithContext(t.Context(), http.MethodPost, "/2019-01-01/count", nil)
+			r.Header.Set("Accept", accept)
+
+			streamTestServer(-1).ServeHTTP(rec, r)
+
+			is.Equal(rec.Header().Get("Content-Type"), contentType)
+		})
+	}
+}
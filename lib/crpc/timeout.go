@@ -0,0 +1,83 @@
+package crpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+)
+
+// TimeoutHeader carries the number of milliseconds the caller is willing to
+// wait for a response. The server applies it as the deadline of the request
+// context, so chained calls stop once the original caller has given up.
+const TimeoutHeader = "Crpc-Timeout"
+
+// requestTimeout parses the TimeoutHeader of an HTTP request, returning zero
+// if it isn't set
+func requestTimeout(r *http.Request) (time.Duration, error) {
+	value := r.Header.Get(TimeoutHeader)
+	if value == "" {
+		return 0, nil
+	}
+
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms <= 0 {
+		return 0, cher.New(cher.BadRequest, cher.M{"header": TimeoutHeader}, cher.New("invalid_timeout", cher.M{"value": value}))
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// setTimeoutHeader sets the TimeoutHeader from the deadline of ctx, if any
+func setTimeoutHeader(ctx context.Context, headers http.Header) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+
+	// the request fails by itself once the deadline has passed, but a
+	// fraction of a millisecond must not be sent as no timeout at all
+	ms := max(time.Until(deadline).Milliseconds(), 1)
+
+	headers.Set(TimeoutHeader, strconv.FormatInt(ms, 10))
+}
+
+// timeoutMiddleware applies a per-method timeout to the request context
+func timeoutMiddleware(timeout time.Duration) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(res http.ResponseWriter, req *Request) error {
+			ctx, cancel := context.WithTimeout(req.Context(), timeout)
+			defer cancel()
+
+			req = withRequestContext(req, ctx)
+
+			return coerceTimeout(ctx, next(res, req))
+		}
+	}
+}
+
+// withRequestContext returns a copy of req using ctx, which is kept in sync
+// with GetRequestContext
+func withRequestContext(req *Request, ctx context.Context) *Request { //nolint:revive // matches http.Request.WithContext
+	r := *req
+	r.originalRequest = req.originalRequest.WithContext(setRequestContext(ctx, &r))
+
+	return &r
+}
+
+// coerceTimeout converts errors caused by the deadline of ctx passing into
+// cher.RequestTimeout, unless they're already a cher error
+func coerceTimeout(ctx context.Context, err error) error {
+	if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+
+	if _, ok := errors.AsType[cher.E](err); ok {
+		return err
+	}
+
+	return cher.New(cher.RequestTimeout, nil)
+}
@@ -0,0 +1,95 @@
+package crpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+)
+
+func timeoutTestServer(deadlines chan<- time.Duration) *Server {
+	wait := func(ctx context.Context) error {
+		if deadline, ok := ctx.Deadline(); ok && deadlines != nil {
+			deadlines <- time.Until(deadline)
+		}
+
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	rpc := NewServer(UnsafeNoAuthentication)
+	rpc.AllowMissingAuthPolicies = true
+	rpc.Register("wait", "2019-01-01", nil, wait)
+	rpc.RegisterWithOptions("wait_briefly", "2019-01-01", nil, wait, WithTimeout(10*time.Millisecond))
+
+	return rpc
+}
+
+func TestTimeout(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	rec := httptest.NewRecorder()
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/2019-01-01/wait_briefly", nil)
+
+	timeoutTestServer(nil).ServeHTTP(rec, r)
+
+	is.Equal(rec.Code, http.StatusInternalServerError)
+	is.Equal(strings.TrimSpace(rec.Body.String()), `{"code":"request_timeout"}`)
+}
+
+func TestTimeoutHeader(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	deadlines := make(chan time.Duration, 1)
+
+	rec := httptest.NewRecorder()
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/2019-01-01/wait", nil)
+	r.Header.Set(TimeoutHeader, "10")
+
+	timeoutTestServer(deadlines).ServeHTTP(rec, r)
+
+	is.True(<-deadlines <= 10*time.Millisecond)
+	is.Equal(rec.Code, http.StatusInternalServerError)
+	is.Equal(strings.TrimSpace(rec.Body.String()), `{"code":"request_timeout"}`)
+
+	rec = httptest.NewRecorder()
+	r, _ = http.NewRequestWithContext(ctx, http.MethodPost, "/2019-01-01/wait", nil)
+	r.Header.Set(TimeoutHeader, "soon")
+
+	timeoutTestServer(nil).ServeHTTP(rec, r)
+
+	is.Equal(rec.Code, http.StatusBadRequest)
+}
+
+func TestTimeoutPropagation(t *testing.T) {
+	is := is.New(t)
+
+	deadlines := make(chan time.Duration, 1)
+
+	srv := httptest.NewServer(timeoutTestServer(deadlines))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+
+	client := NewClient(ctx, srv.URL, nil)
+
+	// the server gives up at the same time as the client, so either can fail
+	// the call first
+	err := client.Do(ctx, "wait", "2019-01-01", nil, nil)
+	is.True(err != nil)
+
+	remaining := <-deadlines
+	is.True(remaining > 0 && remaining <= time.Second)
+
+	if cerr, ok := err.(cher.E); ok { //nolint:errorlint // required for test
+		is.Equal(cerr.Code, cher.RequestTimeout)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"maps"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
@@ -176,6 +177,13 @@ func handleResponseWith(res *http.Response,
 		return ClientTransportError{method, path, "could not read response body stream", err}
 	}
 
+	if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mediaType == cher.ProblemContentType {
+		var problem cher.Problem
+		if err := json.Unmarshal(resBody, &problem); err == nil {
+			return problem.E()
+		}
+	}
+
 	var body cher.E
 	if err := json.Unmarshal(resBody, &body); err == nil && body.Code != "" {
 		return body
@@ -206,3 +206,25 @@ func TestErrorCatching(t *testing.T) {
 	is.Equal("internal_server_error", err.(cher.E).Code) //nolint:errorlint,forcetypeassert // required for test
 	is.True(gock.IsDone())
 }
+
+func TestProblemUnmarshaling(t *testing.T) {
+	is := is.New(t)
+
+	defer gock.Off()
+
+	responseError := cher.E{Code: "test_error", Meta: cher.M{"foo": "bar"}}
+
+	gock.New("http://coo.va/").
+		Get("/test").
+		Reply(http.StatusConflict).
+		JSON(responseError.Problem()).
+		SetHeader("Content-Type", cher.ProblemContentType)
+
+	client := NewClient("http://coo.va/", nil)
+	gock.InterceptClient(client.Client)
+
+	err := client.Do(t.Context(), "GET", "test", nil, nil, nil)
+	is.True(err != nil)
+	is.Equal(responseError, err.(cher.E)) //nolint:errorlint,forcetypeassert // required for test
+	is.True(gock.IsDone())
+}
@@ -0,0 +1,115 @@
+package merr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// fingerprintLength is the number of hex characters fingerprints are cut to
+const fingerprintLength = 16
+
+var (
+	// closureSuffixRegex matches the suffixes the compiler gives closures and
+	// goroutine wrappers, e.g. `.func1`, `.func2.3` or `.gowrap1`
+	closureSuffixRegex = regexp.MustCompile(`(\.(func|gowrap)?\d+)+$`)
+
+	// typeParamsRegex matches the elided type parameters of generic functions
+	typeParamsRegex = regexp.MustCompile(`\[[^\]]*\]`)
+)
+
+// Fingerprint returns an identifier of the kind of error, for grouping and
+// deduplicating errors in logs and alerts.
+//
+// It's derived from the code, the codes of the reasons, and the functions of
+// the stack, so it changes neither with meta nor with line numbers, and stays
+// the same across releases until the code path producing the error changes.
+// Reasons which aren't merr errors are identified by their Code field if they
+// have one, such as cher.E, and otherwise by their type, along with the
+// reasons in their Reasons field if they have one.
+func (e E) Fingerprint() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "code:%s\n", e.Code)
+	writeReasonFingerprints(&sb, e.Reasons, 1)
+
+	for _, frame := range e.Stack {
+		if fn := normalizeFunction(frame.Function); fn != "" {
+			fmt.Fprintf(&sb, "func:%s\n", fn)
+		}
+	}
+
+	sum := sha256.Sum256([]byte(sb.String()))
+
+	return hex.EncodeToString(sum[:])[:fingerprintLength]
+}
+
+func writeReasonFingerprints(sb *strings.Builder, reasons []error, depth int) {
+	for _, reason := range reasons {
+		switch reason := reason.(type) {
+		case E:
+			fmt.Fprintf(sb, "reason:%d:%s\n", depth, reason.Code)
+			writeReasonFingerprints(sb, reason.Reasons, depth+1)
+
+		case Code:
+			fmt.Fprintf(sb, "reason:%d:%s\n", depth, reason)
+
+		default:
+			fmt.Fprintf(sb, "reason:%d:%s\n", depth, reasonIdentifier(reason))
+			writeReasonFingerprints(sb, nestedReasons(reason), depth+1)
+		}
+	}
+}
+
+// reasonIdentifier identifies a reason which isn't a merr error, without its
+// message, which may contain data specific to the occurrence
+func reasonIdentifier(reason error) string {
+	rv := reflect.Indirect(reflect.ValueOf(reason))
+
+	if rv.Kind() == reflect.Struct {
+		if code := rv.FieldByName("Code"); code.IsValid() && code.Kind() == reflect.String {
+			return code.String()
+		}
+	}
+
+	return fmt.Sprintf("%T", reason)
+}
+
+// nestedReasons returns the reasons of a reason which isn't a merr error from
+// its Reasons field, if it has one, such as those of cher.E
+func nestedReasons(reason error) []error {
+	rv := reflect.Indirect(reflect.ValueOf(reason))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	field := rv.FieldByName("Reasons")
+	if !field.IsValid() || field.Kind() != reflect.Slice {
+		return nil
+	}
+
+	var reasons []error
+	for i := range field.Len() {
+		if err, ok := field.Index(i).Interface().(error); ok {
+			reasons = append(reasons, err)
+		}
+	}
+
+	return reasons
+}
+
+// normalizeFunction removes the parts of a function name which may change
+// between builds, returning an empty string for runtime frames
+func normalizeFunction(fn string) string {
+	if strings.HasPrefix(fn, "runtime.") {
+		return ""
+	}
+
+	fn = typeParamsRegex.ReplaceAllString(fn, "")
+	fn = closureSuffixRegex.ReplaceAllString(fn, "")
+
+	return fn
+}
@@ -0,0 +1,105 @@
+package merr
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+)
+
+type codedError struct {
+	Code string
+}
+
+func (e codedError) Error() string {
+	return e.Code
+}
+
+func newFingerprintError(ctx context.Context, code Code, meta M, reasons ...error) E {
+	if meta == nil {
+		return New(ctx, code, meta, reasons...)
+	}
+
+	// a different line of the same function
+	return New(ctx, code, meta, reasons...)
+}
+
+func TestFingerprint(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	base := newFingerprintError(ctx, "foo", nil, New(ctx, "bar", nil))
+
+	is.Equal(len(base.Fingerprint()), fingerprintLength)
+
+	// meta and line numbers don't change the fingerprint
+	is.Equal(base.Fingerprint(), newFingerprintError(ctx, "foo", M{"id": 1}, New(ctx, "bar", M{"id": 2})).Fingerprint())
+
+	// codes and reason codes do
+	is.True(base.Fingerprint() != newFingerprintError(ctx, "baz", nil, New(ctx, "bar", nil)).Fingerprint())
+	is.True(base.Fingerprint() != newFingerprintError(ctx, "foo", nil, New(ctx, "baz", nil)).Fingerprint())
+	is.True(base.Fingerprint() != newFingerprintError(ctx, "foo", nil).Fingerprint())
+
+	// and so does where the error is created
+	is.True(base.Fingerprint() != New(ctx, "foo", nil, New(ctx, "bar", nil)).Fingerprint())
+}
+
+func TestFingerprintForeignReasons(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	fingerprint := func(reason error) string {
+		return newFingerprintError(ctx, "foo", nil, reason).Fingerprint()
+	}
+
+	// messages of reasons don't change the fingerprint, but their codes do
+	is.Equal(fingerprint(errors.New("user 1 not found")), fingerprint(errors.New("user 2 not found")))
+	is.Equal(fingerprint(codedError{"bar"}), fingerprint(&codedError{"bar"}))
+	is.True(fingerprint(codedError{"bar"}) != fingerprint(codedError{"baz"}))
+}
+
+func TestFingerprintCherReasons(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	fingerprint := func(reason error) string {
+		return newFingerprintError(ctx, "foo", nil, reason).Fingerprint()
+	}
+
+	base := fingerprint(cher.New("bar", nil, cher.New("baz", nil)))
+
+	// the reasons of cher errors are part of the fingerprint, but not their meta
+	is.Equal(base, fingerprint(cher.New("bar", cher.M{"id": 1}, cher.New("baz", cher.M{"id": 2}))))
+	is.True(base != fingerprint(cher.New("bar", nil, cher.New("qux", nil))))
+	is.True(base != fingerprint(cher.New("bar", nil)))
+	is.True(base != fingerprint(cher.New("bar", nil, cher.New("baz", nil, cher.New("qux", nil)))))
+
+	// nesting is kept apart from siblings
+	is.True(fingerprint(cher.New("bar", nil, cher.New("baz", nil), cher.New("qux", nil))) !=
+		fingerprint(cher.New("bar", nil, cher.New("baz", nil, cher.New("qux", nil)))))
+}
+
+func TestNormalizeFunction(t *testing.T) {
+	tests := []struct {
+		fn   string
+		want string
+	}{
+		{"github.com/foo/bar.Baz", "github.com/foo/bar.Baz"},
+		{"github.com/foo/bar.(*Server).Serve.func1", "github.com/foo/bar.(*Server).Serve"},
+		{"github.com/foo/bar.Baz.func2.3", "github.com/foo/bar.Baz"},
+		{"github.com/foo/bar.Baz.gowrap1", "github.com/foo/bar.Baz"},
+		{"github.com/foo/bar.Map[...].func1", "github.com/foo/bar.Map"},
+		{"github.com/foo/v2.Step2", "github.com/foo/v2.Step2"},
+		{"runtime.goexit", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fn, func(t *testing.T) {
+			is := is.New(t)
+
+			is.Equal(normalizeFunction(test.fn), test.want)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package merr
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/kr/pretty"
+	"github.com/wearemojo/mojo-public-go/lib/redact"
 	"github.com/wearemojo/mojo-public-go/lib/stacktrace"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -86,8 +88,12 @@ type Fields struct {
 	Reasons []error            `json:"reasons"`
 }
 
-// MarshalJSON ensures that all reasons are JSON serializable.
+// MarshalJSON ensures that all reasons are JSON serializable, and that meta
+// marked sensitive by the default redact policy is redacted, including in
+// reasons such as cher errors which don't redact themselves.
 func (f Fields) MarshalJSON() ([]byte, error) {
+	f.Meta = redact.Meta(f.Meta)
+
 	// Alias to avoid infinite recursion
 	type Alias Fields
 	aux := struct {
@@ -95,21 +101,59 @@ func (f Fields) MarshalJSON() ([]byte, error) {
 
 		Reasons []any `json:"reasons"`
 	}{
-		Alias: (*Alias)(&f),
+		Alias:   (*Alias)(&f),
+		Reasons: marshalReasons(f.Reasons),
 	}
 
-	aux.Reasons = make([]any, len(f.Reasons))
-	for idx, reason := range f.Reasons {
-		marshaledReason, err := json.Marshal(reason)
+	return json.Marshal(aux)
+}
+
+// MarshalJSON redacts meta marked sensitive by the default redact policy, as
+// Fields.MarshalJSON does.
+func (e E) MarshalJSON() ([]byte, error) {
+	// Alias to avoid infinite recursion
+	type Alias E
+	alias := Alias(e)
+	alias.Meta = redact.Meta(e.Meta)
+
+	aux := struct {
+		*Alias
+
+		Reasons []any `json:"reasons"`
+	}{
+		Alias: &alias,
+	}
+
+	if e.Reasons != nil {
+		aux.Reasons = marshalReasons(e.Reasons)
+	}
+
+	return json.Marshal(aux)
+}
+
+func marshalReasons(reasons []error) []any {
+	marshaled := make([]any, len(reasons))
+	for idx, reason := range reasons {
+		data, err := json.Marshal(reason)
 		if err != nil {
 			// If the reason cannot be marshaled, fall back to its string representation
-			aux.Reasons[idx] = pretty.Sprint(reason)
-		} else {
-			aux.Reasons[idx] = json.RawMessage(marshaledReason)
+			marshaled[idx] = pretty.Sprint(reason)
+			continue
 		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			marshaled[idx] = json.RawMessage(data)
+			continue
+		}
+
+		marshaled[idx] = redact.Default().Value(value)
 	}
 
-	return json.Marshal(aux)
+	return marshaled
 }
 
 func (e E) Fields() Fields {
@@ -143,7 +187,7 @@ func (e E) Error() string {
 	str.WriteString(string(e.Code))
 
 	if len(e.Meta) > 0 {
-		fmt.Fprintf(&str, " (%v)", e.Meta)
+		fmt.Fprintf(&str, " (%v)", redact.Meta(e.Meta))
 	}
 
 	for _, reason := range e.Reasons {
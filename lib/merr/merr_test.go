@@ -9,6 +9,7 @@ import (
 
 	"github.com/matryer/is"
 	"github.com/wearemojo/mojo-public-go/lib/gjson"
+	"github.com/wearemojo/mojo-public-go/lib/redact"
 	"github.com/wearemojo/mojo-public-go/lib/stacktrace"
 )
 
@@ -225,3 +226,47 @@ func TestReasonsMarshallingEnforcing(t *testing.T) {
 	is.Equal(len(reasons), 1)
 	is.Equal(reasons[0], "merr.unmarshallableError{GoUnmarshalYourself:func(context.Context) error {...}}")
 }
+
+// metaError is a reason which doesn't redact its own meta
+type metaError struct {
+	Meta map[string]any `json:"meta"`
+}
+
+func (metaError) Error() string { return "meta_error" }
+
+func TestSensitiveMetaIsRedacted(t *testing.T) {
+	is := is.New(t)
+	ctx := t.Context()
+
+	err := New(ctx, "foo", M{
+		"email":  redact.Wrap("user@example.com"),
+		"token":  "secret-token",
+		"nested": map[string]any{"password": "hunter2"},
+	},
+		New(ctx, "bar", M{"token": "reason-token"}),
+		metaError{Meta: map[string]any{"authorization": "Bearer abc"}},
+	)
+
+	fieldsJSON, jsonErr := json.Marshal(err.Fields())
+	is.NoErr(jsonErr)
+
+	errJSON, jsonErr := json.Marshal(err)
+	is.NoErr(jsonErr)
+
+	for name, output := range map[string]string{
+		"Fields": string(fieldsJSON),
+		"E":      string(errJSON),
+		"Error":  err.Error(),
+		"String": err.String(),
+	} {
+		for _, value := range []string{"user@example.com", "secret-token", "hunter2", "reason-token", "Bearer abc"} {
+			if strings.Contains(output, value) {
+				t.Errorf("%s output contains %q", name, value)
+			}
+		}
+
+		is.True(strings.Contains(output, redact.Placeholder)) // redacted values are marked
+	}
+
+	is.Equal(err.Meta["token"], "secret-token") // the error itself is untouched
+}
@@ -38,6 +38,12 @@ func (rw *responseWriter) Write(bytes []byte) (int, error) {
 	return rw.ResponseWriter.Write(bytes)
 }
 
+// Unwrap allows http.ResponseController to reach the underlying writer, e.g.
+// for flushing streamed responses
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // Logger returns a middleware handler that wraps subsequent middleware/handlers and logs
 // request information AFTER the request has completed. It also injects a request-scoped
 // logger on the context which can be set, read and updated using clog lib
@@ -9,6 +9,7 @@ import (
 	"github.com/wearemojo/mojo-public-go/lib/gcp"
 	"github.com/wearemojo/mojo-public-go/lib/merr"
 	"github.com/wearemojo/mojo-public-go/lib/mlog/indirect"
+	"github.com/wearemojo/mojo-public-go/lib/redact"
 	"github.com/wearemojo/mojo-public-go/lib/stacktrace"
 )
 
@@ -76,7 +77,7 @@ func log(ctx context.Context, level logrus.Level, err merr.Merrer) {
 	if _, ok := logger.Logger.Formatter.(*logrus.TextFormatter); ok {
 		newFields := logrus.Fields{
 			"code":    merrFields.Code,
-			"meta":    merrFields.Meta,
+			"meta":    redact.Meta(merrFields.Meta),
 			"stack":   merrFields.Stack,
 			"reasons": merrFields.Reasons,
 		}
@@ -93,6 +94,9 @@ func log(ctx context.Context, level logrus.Level, err merr.Merrer) {
 		fields = newFields
 	}
 
+	// lets alerting group occurrences of the same error across releases
+	fields["fingerprint"] = merr.Fingerprint()
+
 	if merr.Stack != nil && level > logrus.InfoLevel {
 		fields["stack_trace"] = stacktrace.FormatFrames(merr.Stack)
 	}
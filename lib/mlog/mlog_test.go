@@ -0,0 +1,72 @@
+package mlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/sirupsen/logrus"
+	"github.com/wearemojo/mojo-public-go/lib/cher"
+	"github.com/wearemojo/mojo-public-go/lib/clog"
+	"github.com/wearemojo/mojo-public-go/lib/merr"
+	"github.com/wearemojo/mojo-public-go/lib/redact"
+)
+
+func TestSensitiveMetaIsRedacted(t *testing.T) {
+	formatters := map[string]logrus.Formatter{
+		"JSON": &logrus.JSONFormatter{},
+		"Text": &logrus.TextFormatter{DisableColors: true},
+	}
+
+	for name, formatter := range formatters {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &buf
+			logger.Formatter = formatter
+
+			ctx := clog.Set(t.Context(), logrus.NewEntry(logger))
+
+			Warn(ctx, merr.New(ctx, "foo", merr.M{
+				"email": redact.Wrap("user@example.com"),
+				"token": "secret-token",
+			},
+				merr.New(ctx, "bar", merr.M{"password": "hunter2"}),
+				cher.New("baz", cher.M{"authorization": "Bearer abc"}),
+			))
+
+			output := buf.String()
+			if output == "" {
+				t.Fatal("nothing was logged")
+			}
+
+			for _, value := range []string{"user@example.com", "secret-token", "hunter2", "Bearer abc"} {
+				if strings.Contains(output, value) {
+					t.Errorf("log output contains %q:\n%s", value, output)
+				}
+			}
+		})
+	}
+}
+
+func TestFingerprintIsLogged(t *testing.T) {
+	is := is.New(t)
+
+	var buf bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &buf
+	logger.Formatter = &logrus.JSONFormatter{}
+
+	ctx := clog.Set(t.Context(), logrus.NewEntry(logger))
+	err := merr.New(ctx, "foo", merr.M{"id": 1})
+
+	Warn(ctx, err)
+
+	var entry map[string]any
+	is.NoErr(json.Unmarshal(buf.Bytes(), &entry))
+	is.Equal(entry["fingerprint"], err.Fingerprint())
+}
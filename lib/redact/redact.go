@@ -0,0 +1,231 @@
+// Package redact keeps sensitive values, such as emails and tokens, in error
+// meta out of logs and responses to clients.
+package redact
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// Placeholder replaces sensitive values when they are serialized.
+const Placeholder = "[REDACTED]"
+
+// Sensitive wraps a value which must never be serialized or formatted, e.g.
+// an email address put in error meta to help debugging in-process. It is
+// marshaled and formatted as Placeholder wherever it ends up, including
+// responses to clients, while the value remains available with Value.
+type Sensitive[T any] struct {
+	value T
+}
+
+// Wrap marks a value as sensitive.
+func Wrap[T any](value T) Sensitive[T] {
+	return Sensitive[T]{value: value}
+}
+
+// Value returns the wrapped value.
+func (s Sensitive[T]) Value() T {
+	return s.value
+}
+
+func (Sensitive[T]) isSensitive() {}
+
+func (Sensitive[T]) String() string {
+	return Placeholder
+}
+
+func (Sensitive[T]) GoString() string {
+	return Placeholder
+}
+
+func (Sensitive[T]) Format(f fmt.State, _ rune) {
+	_, _ = f.Write([]byte(Placeholder))
+}
+
+func (Sensitive[T]) MarshalText() ([]byte, error) {
+	return []byte(Placeholder), nil
+}
+
+func (Sensitive[T]) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + Placeholder + `"`), nil
+}
+
+type sensitive interface {
+	isSensitive()
+}
+
+// Policy decides which meta values are sensitive, besides those wrapped with
+// Wrap, which always are. It is immutable once created, so can be shared.
+type Policy struct {
+	keys  []string
+	types []reflect.Type
+}
+
+// NewPolicy returns a policy marking sensitive the values under keys, compared
+// case-insensitively at any depth, and values of types, wherever they appear.
+func NewPolicy(keys []string, types ...reflect.Type) *Policy {
+	return &Policy{
+		keys:  slices.Clone(keys),
+		types: slices.Clone(types),
+	}
+}
+
+// With returns a copy of the policy which also marks sensitive the values
+// under keys and of types.
+func (p *Policy) With(keys []string, types ...reflect.Type) *Policy {
+	return NewPolicy(slices.Concat(p.keys, keys), slices.Concat(p.types, types)...)
+}
+
+var defaultPolicy atomic.Pointer[Policy]
+
+func init() {
+	defaultPolicy.Store(NewPolicy([]string{
+		"access_token",
+		"api_key",
+		"authorization",
+		"cookie",
+		"password",
+		"refresh_token",
+		"secret",
+		"token",
+	}))
+}
+
+// Default returns the policy applied when errors are logged. It lists
+// common credential keys until replaced with SetDefault.
+func Default() *Policy {
+	return defaultPolicy.Load()
+}
+
+// SetDefault replaces the default policy, typically at startup with one built
+// from Default().With(...) adding the service's own keys and types.
+func SetDefault(p *Policy) {
+	if p == nil {
+		panic("redact: nil policy")
+	}
+
+	defaultPolicy.Store(p)
+}
+
+var clientPolicy atomic.Pointer[Policy]
+
+// Client returns the policy applied when cher errors are serialized, such as
+// when they are sent to clients. It is the default policy until replaced with
+// SetClient.
+func Client() *Policy {
+	if p := clientPolicy.Load(); p != nil {
+		return p
+	}
+
+	return Default()
+}
+
+// SetClient replaces the client policy, e.g. with one leaving out keys whose
+// values clients need to read, such as the token of a challenge flow.
+func SetClient(p *Policy) {
+	if p == nil {
+		panic("redact: nil policy")
+	}
+
+	clientPolicy.Store(p)
+}
+
+// Meta returns a copy of meta with the values the default policy marks
+// sensitive replaced by Placeholder, including within nested maps and slices.
+// meta itself is left untouched.
+func Meta[M ~map[string]any](meta M) M {
+	if meta == nil {
+		return nil
+	}
+
+	return M(Default().Map(meta))
+}
+
+// ClientMeta is like Meta, but applies the client policy.
+func ClientMeta[M ~map[string]any](meta M) M {
+	if meta == nil {
+		return nil
+	}
+
+	return M(Client().Map(meta))
+}
+
+// Map returns a copy of m with the values the policy marks sensitive replaced
+// by Placeholder, including within nested maps and slices.
+func (p *Policy) Map(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+
+	redacted := make(map[string]any, len(m))
+	for key, value := range m {
+		if p.isSensitiveKey(key) {
+			redacted[key] = Placeholder
+		} else {
+			redacted[key] = p.Value(value)
+		}
+	}
+
+	return redacted
+}
+
+// Value returns value, or Placeholder if the policy marks it sensitive. Maps
+// with string keys and slices are copied with their elements redacted.
+// Structs are returned as they are, so must redact themselves when marshaled.
+func (p *Policy) Value(value any) any {
+	if value == nil {
+		return nil
+	}
+
+	if _, ok := value.(sensitive); ok {
+		return Placeholder
+	}
+
+	rv := reflect.ValueOf(value)
+	for _, typ := range p.types {
+		if rv.Type() == typ {
+			return Placeholder
+		}
+	}
+
+	switch rv.Kind() { //nolint:exhaustive // other kinds can't contain meta
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String || rv.IsNil() {
+			return value
+		}
+
+		m := make(map[string]any, rv.Len())
+		for iter := rv.MapRange(); iter.Next(); {
+			m[iter.Key().String()] = iter.Value().Interface()
+		}
+
+		return p.Map(m)
+
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 || (rv.Kind() == reflect.Slice && rv.IsNil()) {
+			return value
+		}
+
+		s := make([]any, rv.Len())
+		for i := range s {
+			s[i] = p.Value(rv.Index(i).Interface())
+		}
+
+		return s
+	}
+
+	return value
+}
+
+func (p *Policy) isSensitiveKey(key string) bool {
+	for _, sensitiveKey := range p.keys {
+		if strings.EqualFold(key, sensitiveKey) {
+			return true
+		}
+	}
+
+	return false
+}
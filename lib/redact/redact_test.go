@@ -0,0 +1,120 @@
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+type email string
+
+func TestSensitive(t *testing.T) {
+	is := is.New(t)
+
+	s := Wrap("user@example.com")
+	is.Equal(s.Value(), "user@example.com")
+
+	data, err := json.Marshal(map[string]any{"email": s})
+	is.NoErr(err)
+	is.Equal(string(data), `{"email":"[REDACTED]"}`)
+
+	for _, verb := range []string{"%v", "%+v", "%#v", "%s", "%q", "%x"} {
+		is.Equal(fmt.Sprintf(verb, s), Placeholder) // formatting never reveals the value
+	}
+
+	is.Equal(fmt.Sprintf("%v", Wrap(42)), Placeholder)
+}
+
+func TestPolicy(t *testing.T) {
+	is := is.New(t)
+
+	p := NewPolicy([]string{"password"}, reflect.TypeFor[email]())
+
+	meta := map[string]any{
+		"Password": "hunter2",
+		"contact":  email("user@example.com"),
+		"token":    Wrap("abc"),
+		"user": map[string]string{
+			"name":     "Jo",
+			"password": "hunter2",
+		},
+		"attempts": []any{
+			map[string]any{"password": "hunter2"},
+			"ok",
+		},
+		"raw":   []byte("body"),
+		"count": 3,
+	}
+
+	is.Equal(p.Map(meta), map[string]any{
+		"Password": Placeholder,
+		"contact":  Placeholder,
+		"token":    Placeholder,
+		"user": map[string]any{
+			"name":     "Jo",
+			"password": Placeholder,
+		},
+		"attempts": []any{
+			map[string]any{"password": Placeholder},
+			"ok",
+		},
+		"raw":   []byte("body"),
+		"count": 3,
+	})
+
+	is.Equal(meta["Password"], "hunter2") // the original is untouched
+}
+
+func TestMeta(t *testing.T) {
+	is := is.New(t)
+
+	type M map[string]any
+
+	is.Equal(Meta(M(nil)), M(nil))
+	is.Equal(Meta(M{"token": "abc", "foo": "bar"}), M{"token": Placeholder, "foo": "bar"})
+}
+
+func TestPolicyWith(t *testing.T) {
+	is := is.New(t)
+
+	keys := []string{"password"}
+	p := NewPolicy(keys)
+	extended := p.With([]string{"ssn"}, reflect.TypeFor[email]())
+
+	keys[0] = "other" // the policy keeps its own copy
+
+	meta := map[string]any{"password": "hunter2", "ssn": "123", "contact": email("user@example.com")}
+
+	is.Equal(p.Map(meta), map[string]any{"password": Placeholder, "ssn": "123", "contact": email("user@example.com")})
+	is.Equal(extended.Map(meta), map[string]any{"password": Placeholder, "ssn": Placeholder, "contact": Placeholder})
+}
+
+func TestSetDefault(t *testing.T) {
+	is := is.New(t)
+
+	original := Default()
+	t.Cleanup(func() { SetDefault(original) })
+
+	SetDefault(original.With([]string{"ssn"}))
+
+	is.Equal(Meta(map[string]any{"ssn": "123", "token": "abc"}), map[string]any{"ssn": Placeholder, "token": Placeholder})
+}
+
+func TestSetClient(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(Client(), Default()) // the client policy follows the default until set
+
+	original := Client()
+	t.Cleanup(func() { SetClient(original) })
+
+	SetClient(NewPolicy([]string{"password"}))
+
+	meta := map[string]any{"password": "hunter2", "token": "abc"}
+
+	is.Equal(ClientMeta(meta), map[string]any{"password": Placeholder, "token": "abc"})
+	is.Equal(Meta(meta), map[string]any{"password": Placeholder, "token": Placeholder})
+}